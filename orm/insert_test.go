@@ -6,10 +6,12 @@ import (
 	"database/sql/driver"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/Moty1999/web/orm/internal/errs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInserter_SQLite_upsert(t *testing.T) {
@@ -263,3 +265,17 @@ func TestInserter_Exec(t *testing.T) {
 		})
 	}
 }
+
+// 超时之后语句要被取消
+func TestInserter_ExecTimeout(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	mock.ExpectExec("INSERT INTO .*").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(1, 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	res := NewInserter[TestModel](db).Values(&TestModel{}).Exec(ctx)
+	assert.Equal(t, sqlmock.ErrCancelled, res.Err())
+}
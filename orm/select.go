@@ -322,8 +322,15 @@ func (s *Selector[T]) Get(ctx context.Context) (*T, error) {
 		return nil, err
 	}
 
+	// 一定要关掉, 不然连接不会还回去
+	defer rows.Close()
+
 	// 你要确认有没有数据
 	if !rows.Next() {
+		// 查询被取消或者超时的时候, Next 也是返回 false, 不能当成没有数据
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
 		// 要不要返回一个 error ？
 		// 返回 error，
 		return nil, ErrNoRows
@@ -349,18 +356,30 @@ func (s *Selector[T]) GetMulti(ctx context.Context) ([]*T, error) {
 	}
 
 	// 在这里，就是要发起查询，并且处理结果集
-	rows, err := s.sess.queryContext(ctx, query.SQL, query.Args)
+	rows, err := s.sess.queryContext(ctx, query.SQL, query.Args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	for !rows.Next() {
+	var res []*T
+	for rows.Next() {
+		tp := new(T)
+		val := s.creator(s.model, tp)
+		if err = val.SetColumns(rows); err != nil {
+			return nil, err
+		}
+		res = append(res, tp)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
 		// 要不要返回 error ?
 		// 返回 error, 和 sql 包语义保持一致
 		return nil, ErrNoRows
 	}
-
-	panic("implement me!")
+	return res, nil
 }
 
 //func (s *Selector[T]) Select(cols ...string) *Selector[T] {
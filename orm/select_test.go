@@ -7,11 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/Moty1999/web/orm/internal/errs"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSelector_Select(t *testing.T) {
@@ -330,6 +332,51 @@ func TestSelector_Get(t *testing.T) {
 	}
 }
 
+// 超时之后查询要被取消, 不能当成没有数据
+func TestSelector_GetTimeout(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := OpenDB(mockDb)
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "first_name", "age", "last_name"}).AddRow("1", "Tom", "18", "Jerry")
+	mock.ExpectQuery("SELECT .*").WillDelayFor(time.Second).WillReturnRows(rows)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = NewSelector[TestModel](db).Get(ctx)
+	assert.Equal(t, sqlmock.ErrCancelled, err)
+}
+
+func TestSelector_GetMulti(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := OpenDB(mockDb)
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "age", "last_name"}))
+	_, err = NewSelector[TestModel](db).GetMulti(context.Background())
+	assert.Equal(t, ErrNoRows, err)
+
+	rows := sqlmock.NewRows([]string{"id", "first_name", "age", "last_name"}).
+		AddRow("1", "Tom", "18", "Jerry").
+		AddRow("2", "Jerry", "20", nil)
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows)
+	res, err := NewSelector[TestModel](db).Where(C("Id").LT(3)).GetMulti(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*TestModel{
+		{Id: 1, FirstName: "Tom", Age: 18, LastName: &sql.NullString{Valid: true, String: "Jerry"}},
+		{Id: 2, FirstName: "Jerry", Age: 20},
+	}, res)
+
+	// 超时之后查询要被取消, 不能当成没有数据
+	rows = sqlmock.NewRows([]string{"id", "first_name", "age", "last_name"}).AddRow("1", "Tom", "18", "Jerry")
+	mock.ExpectQuery("SELECT .*").WillDelayFor(time.Second).WillReturnRows(rows)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = NewSelector[TestModel](db).GetMulti(ctx)
+	assert.Equal(t, sqlmock.ErrCancelled, err)
+}
+
 func memoryDB(t *testing.T, opts ...DBOption) *DB {
 	dsn := "file:test.db?cache=shared&mode=memory"
 	db, err := Open("sqlite3", dsn,
@@ -0,0 +1,360 @@
+package web
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 绑定数据的来源, 也就是结构体里面的标签名
+const (
+	bindSourcePath   = "path"
+	bindSourceQuery  = "query"
+	bindSourceHeader = "header"
+	bindSourceCookie = "cookie"
+	bindSourceForm   = "form"
+)
+
+var bindSources = []string{bindSourcePath, bindSourceQuery, bindSourceHeader, bindSourceCookie, bindSourceForm}
+
+// tagKeyLayout 时间字段的格式, 不设置的话依次尝试 RFC3339, DateTime, DateOnly
+const tagKeyLayout = "layout"
+
+var ErrUnsupportedMediaType = errors.New("web: 不支持的 Content-Type")
+
+// BodyDecoder 把请求体解析到 val 里面
+type BodyDecoder func(r io.Reader, val any) error
+
+var bodyDecoders = struct {
+	mutex    sync.RWMutex
+	decoders map[string]BodyDecoder
+}{
+	decoders: map[string]BodyDecoder{
+		"application/json": func(r io.Reader, val any) error {
+			return json.NewDecoder(r).Decode(val)
+		},
+		"application/xml": func(r io.Reader, val any) error {
+			return xml.NewDecoder(r).Decode(val)
+		},
+		"text/xml": func(r io.Reader, val any) error {
+			return xml.NewDecoder(r).Decode(val)
+		},
+	},
+}
+
+// RegisterBodyDecoder 注册请求体的解码器, 同一个 media type 会覆盖掉
+func RegisterBodyDecoder(mediaType string, decoder BodyDecoder) {
+	bodyDecoders.mutex.Lock()
+	defer bodyDecoders.mutex.Unlock()
+	bodyDecoders.decoders[mediaType] = decoder
+}
+
+func bodyDecoderOf(mediaType string) (BodyDecoder, bool) {
+	bodyDecoders.mutex.RLock()
+	defer bodyDecoders.mutex.RUnlock()
+	decoder, ok := bodyDecoders.decoders[mediaType]
+	if !ok && strings.HasSuffix(mediaType, "+json") {
+		// application/problem+json 之类的
+		decoder, ok = bodyDecoders.decoders["application/json"]
+	}
+	return decoder, ok
+}
+
+// BindError 某个字段绑定失败
+type BindError struct {
+	// Source 数据来源, 例如 query, path
+	Source string
+	// Key 标签里面的名字
+	Key   string
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("web: 绑定字段 %s 失败, %s %s=%q, %v", e.Field, e.Source, e.Key, e.Value, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// Bind 根据结构体的标签填充 val, val 必须是结构体指针
+// 先按照 Content-Type 解析请求体(表单除外), 然后按照标签覆盖:
+//
+//	type Req struct {
+//		ID    int64     `path:"id"`
+//		Page  int       `query:"page"`
+//		Tags  []string  `query:"tag"`
+//		Token *string   `header:"X-Token"`
+//		Sid   string    `cookie:"sid"`
+//		Name  string    `form:"name"`
+//		Since time.Time `query:"since" layout:"2006-01-02"`
+//	}
+//
+// 请求里面没有的字段保持原样, 所以可以先设置好默认值再 Bind
+// 绑定完之后会按照 validate 标签校验, 校验不通过返回 ValidationErrors
+func (c *Context) Bind(val any) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("web: 只能绑定到结构体指针")
+	}
+	m := bindModelOf(rv.Type().Elem())
+
+	isForm, err := c.bindBody(val)
+	if err != nil {
+		return err
+	}
+
+	for _, fd := range m.fields {
+		vals, err := c.bindValues(fd, isForm)
+		if err != nil {
+			return err
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		if err = setBindField(rv.Elem().FieldByIndex(fd.index), vals, fd.layout); err != nil {
+			return &BindError{Source: fd.source, Key: fd.key, Field: fd.name, Value: vals[0], Err: err}
+		}
+	}
+	return Validate(val)
+}
+
+// bindBody 返回值代表请求体是不是表单, 表单是通过 form 标签绑定的
+func (c *Context) bindBody(val any) (bool, error) {
+	ct := c.Req.Header.Get("Content-Type")
+	if ct == "" || c.Req.Body == nil || c.Req.Body == http.NoBody {
+		return false, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, ct)
+	}
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data" {
+		return true, nil
+	}
+	decoder, ok := bodyDecoderOf(mediaType)
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+	// 没有请求体不算错
+	if err = decoder(c.Req.Body, val); err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return false, nil
+}
+
+func (c *Context) bindValues(fd *bindField, isForm bool) ([]string, error) {
+	switch fd.source {
+	case bindSourcePath:
+		if val, ok := c.PathParams.Get(fd.key); ok {
+			return []string{val}, nil
+		}
+	case bindSourceQuery:
+		if c.queryValues == nil {
+			c.queryValues = c.Req.URL.Query()
+		}
+		return c.queryValues[fd.key], nil
+	case bindSourceHeader:
+		return c.Req.Header.Values(fd.key), nil
+	case bindSourceCookie:
+		if cookie, err := c.Req.Cookie(fd.key); err == nil {
+			return []string{cookie.Value}, nil
+		}
+	case bindSourceForm:
+		if err := c.parseForm(isForm); err != nil {
+			return nil, err
+		}
+		return c.Req.Form[fd.key], nil
+	}
+	return nil, nil
+}
+
+func (c *Context) parseForm(isForm bool) error {
+	if c.Req.Form != nil {
+		return nil
+	}
+	if isForm {
+		err := c.Req.ParseMultipartForm(32 << 20)
+		if !errors.Is(err, http.ErrNotMultipart) {
+			return err
+		}
+	}
+	return c.Req.ParseForm()
+}
+
+// bindModel 结构体的绑定元数据, 和 orm 的 model 一样, 解析一次之后缓存起来
+type bindModel struct {
+	fields []*bindField
+}
+
+type bindField struct {
+	// 字段名, 组合进来的结构体的字段直接用它自己的名字
+	name   string
+	index  []int
+	source string
+	key    string
+	layout string
+}
+
+var bindModels sync.Map
+
+func bindModelOf(typ reflect.Type) *bindModel {
+	if m, ok := bindModels.Load(typ); ok {
+		return m.(*bindModel)
+	}
+	m := &bindModel{}
+	parseBindFields(typ, nil, m)
+	bindModels.Store(typ, m)
+	return m
+}
+
+func parseBindFields(typ reflect.Type, index []int, m *bindModel) {
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		// 没有导出的组合结构体, 它导出的字段还是可以设置的
+		if !fd.IsExported() && !fd.Anonymous {
+			continue
+		}
+		fdIndex := append(append([]int{}, index...), i)
+
+		tagged := false
+		for _, source := range bindSources {
+			key, ok := fd.Tag.Lookup(source)
+			if !ok || key == "" || key == "-" || !fd.IsExported() {
+				continue
+			}
+			tagged = true
+			if source == bindSourceHeader {
+				key = http.CanonicalHeaderKey(key)
+			}
+			m.fields = append(m.fields, &bindField{
+				name:   fd.Name,
+				index:  fdIndex,
+				source: source,
+				key:    key,
+				layout: fd.Tag.Get(tagKeyLayout),
+			})
+		}
+		// 组合进来的结构体, 把它的字段当成自己的
+		if !tagged && fd.Anonymous && fd.Type.Kind() == reflect.Struct {
+			parseBindFields(fd.Type, fdIndex, m)
+		}
+	}
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// setBindField 切片会用上所有的值, 其它的类型只用第一个值
+func setBindField(v reflect.Value, vals []string, layout string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setBindField(v.Elem(), vals, layout)
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setBindValue(slice.Index(i), val, layout); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setBindValue(v, vals[0], layout)
+}
+
+func setBindValue(v reflect.Value, val string, layout string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setBindValue(v.Elem(), val, layout)
+	}
+
+	switch v.Type() {
+	case timeType:
+		t, err := parseTime(val, layout)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// []byte
+		v.SetBytes([]byte(val))
+	default:
+		return fmt.Errorf("web: 不支持的类型 %s", v.Type())
+	}
+	return nil
+}
+
+func parseTime(val string, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, val)
+	}
+	var err error
+	for _, l := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		var t time.Time
+		if t, err = time.Parse(l, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
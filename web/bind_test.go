@@ -0,0 +1,167 @@
+package web
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bindPage struct {
+	Page int  `query:"page"`
+	Size *int `query:"size"`
+}
+
+type bindReq struct {
+	bindPage
+	ID      int64         `path:"id"`
+	Tags    []string      `query:"tag"`
+	IDs     []uint16      `query:"ids"`
+	Since   time.Time     `query:"since" layout:"2006-01-02"`
+	Until   *time.Time    `query:"until"`
+	Timeout time.Duration `query:"timeout"`
+	Debug   bool          `query:"debug"`
+	Ratio   float32       `query:"ratio"`
+	UID     uuid.UUID     `query:"uid"`
+	Token   *string       `header:"x-token"`
+	Sid     string        `cookie:"sid"`
+	Name    string        `json:"name" xml:"name" form:"name"`
+	Email   string        `json:"email" xml:"email"`
+	Ignored string        `query:"-"`
+}
+
+func TestContext_Bind(t *testing.T) {
+	server := NewHTTPServer()
+	var got bindReq
+	var bindErr error
+	server.Post("/user/:id", func(ctx *Context) {
+		got = bindReq{Email: "default"}
+		bindErr = ctx.Bind(&got)
+	})
+
+	size := 20
+	token := "abc"
+	until := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	uid := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	query := "/user/123?page=2&size=20&tag=a&tag=b&ids=1&ids=2&since=2023-09-01&until=2023-10-01T12:00:00Z" +
+		"&timeout=1.5s&debug=true&ratio=0.5&uid=" + uid.String() + "&Ignored=x"
+	wantFromQuery := bindReq{
+		bindPage: bindPage{Page: 2, Size: &size},
+		ID:       123,
+		Tags:     []string{"a", "b"},
+		IDs:      []uint16{1, 2},
+		Since:    time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+		Until:    &until,
+		Timeout:  1500 * time.Millisecond,
+		Debug:    true,
+		Ratio:    0.5,
+		UID:      uid,
+		Token:    &token,
+		Sid:      "s1",
+	}
+
+	multipartBody := &bytes.Buffer{}
+	mw := multipart.NewWriter(multipartBody)
+	require.NoError(t, mw.WriteField("name", "Tom"))
+	require.NoError(t, mw.Close())
+
+	testCases := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        bindReq
+		wantErr     string
+	}{
+		{
+			name:        "json",
+			path:        query,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name":"Tom","email":"tom@example.com"}`,
+			want: func() bindReq {
+				want := wantFromQuery
+				want.Name = "Tom"
+				want.Email = "tom@example.com"
+				return want
+			}(),
+		},
+		{
+			name:        "xml",
+			path:        "/user/1",
+			contentType: "application/xml",
+			body:        `<bindReq><name>Tom</name></bindReq>`,
+			want:        bindReq{ID: 1, Name: "Tom", Email: "default", Token: &token, Sid: "s1"},
+		},
+		{
+			name:        "urlencoded",
+			path:        "/user/1",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=Tom",
+			want:        bindReq{ID: 1, Name: "Tom", Email: "default", Token: &token, Sid: "s1"},
+		},
+		{
+			name:        "multipart",
+			path:        "/user/1",
+			contentType: mw.FormDataContentType(),
+			body:        multipartBody.String(),
+			want:        bindReq{ID: 1, Name: "Tom", Email: "default", Token: &token, Sid: "s1"},
+		},
+		{
+			name:        "json no body",
+			path:        "/user/1",
+			contentType: "application/json",
+			want:        bindReq{ID: 1, Email: "default", Token: &token, Sid: "s1"},
+		},
+		{
+			name:        "unsupported media type",
+			path:        "/user/1",
+			contentType: "text/csv",
+			body:        "a,b",
+			wantErr:     "web: 不支持的 Content-Type: text/csv",
+		},
+		{
+			name:    "bad int",
+			path:    "/user/1?page=abc",
+			wantErr: `web: 绑定字段 Page 失败, query page="abc", strconv.ParseInt: parsing "abc": invalid syntax`,
+		},
+		{
+			name:    "overflow",
+			path:    "/user/1?ids=70000",
+			wantErr: `web: 绑定字段 IDs 失败, query ids="70000", strconv.ParseUint: parsing "70000": value out of range`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			req.Header.Set("X-Token", token)
+			req.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+			server.ServeHTTP(httptest.NewRecorder(), req)
+			if tc.wantErr != "" {
+				require.Error(t, bindErr)
+				assert.Equal(t, tc.wantErr, bindErr.Error())
+				return
+			}
+			require.NoError(t, bindErr)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestContext_Bind_NotStruct(t *testing.T) {
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil)}
+	var i int
+	assert.Error(t, ctx.Bind(&i))
+	assert.Error(t, ctx.Bind(bindReq{}))
+	assert.Error(t, ctx.Bind((*bindReq)(nil)))
+}
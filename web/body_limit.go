@@ -0,0 +1,72 @@
+package web
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// MaxBodySize 路由级别的请求体大小限制, 会覆盖掉 ServerWithMaxBodySize 的全局限制
+// 例如 server.Use(http.MethodPost, "/upload", web.MaxBodySize(100<<20))
+func MaxBodySize(n int64) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if !ctx.limitBody(n) {
+				ctx.respBodyTooLarge()
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// limitBody 把请求体限制在 n 个字节以内
+// Content-Length 已经超过了的话直接返回 false
+func (c *Context) limitBody(n int64) bool {
+	if c.Req.ContentLength > n {
+		return false
+	}
+	c.wrapBody(n)
+	return true
+}
+
+// wrapBody 只包装请求体, 不检查 Content-Length, 留到执行 handler 之前按照最终的限制检查
+// 每次都是包装原始的请求体, 所以后设置的限制会覆盖先设置的
+func (c *Context) wrapBody(n int64) {
+	c.bodyLimit = n
+	if c.Req.Body == nil || c.Req.Body == http.NoBody {
+		return
+	}
+	if c.rawBody == nil {
+		c.rawBody = c.Req.Body
+	}
+	c.Req.Body = &limitedBody{
+		ctx:  c,
+		body: http.MaxBytesReader(c.Resp, c.rawBody, n),
+	}
+}
+
+func (c *Context) respBodyTooLarge() {
+	c.RespStatusCode = http.StatusRequestEntityTooLarge
+	c.RespData = []byte("Request Entity Too Large")
+}
+
+// limitedBody 记录下来有没有超过限制
+// 这样即便 handler 吞掉了错误, 框架也能返回 413
+type limitedBody struct {
+	ctx  *Context
+	body io.ReadCloser
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.body.Read(p)
+	var maxErr *http.MaxBytesError
+	if err != nil && errors.As(err, &maxErr) {
+		l.ctx.bodyTooLarge = true
+	}
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	return l.body.Close()
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	type User struct {
+		Name string `json:"name"`
+	}
+	// 413 也要经过全局的中间件, 例如 accesslog
+	var logged int
+	logMdl := func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			logged = ctx.RespStatusCode
+		}
+	}
+	server := NewHTTPServer(ServerWithMaxBodySize(32), ServerWithMiddleware(logMdl))
+	var called bool
+	handler := func(ctx *Context) {
+		called = true
+		var u User
+		if err := ctx.BindJSON(&u); err != nil {
+			// 故意吞掉错误, 框架还是要返回 413
+			ctx.RespStatusCode = http.StatusBadRequest
+			ctx.RespData = []byte(err.Error())
+			return
+		}
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte(u.Name)
+	}
+	server.Post("/user", handler)
+	server.Post("/upload", handler)
+	server.Post("/tiny", handler)
+	server.Use(http.MethodPost, "/upload", MaxBodySize(1024))
+	server.Use(http.MethodPost, "/tiny", MaxBodySize(8))
+
+	longName := `{"name":"` + strings.Repeat("a", 64) + `"}`
+	testCases := []struct {
+		name       string
+		path       string
+		body       string
+		chunked    bool
+		wantCode   int
+		wantData   string
+		wantCalled bool
+	}{
+		{
+			name:       "ok",
+			path:       "/user",
+			body:       `{"name":"Tom"}`,
+			wantCode:   http.StatusOK,
+			wantData:   "Tom",
+			wantCalled: true,
+		},
+		{
+			// Content-Length 超过了, handler 都不会执行
+			name:     "content length",
+			path:     "/user",
+			body:     longName,
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantData: "Request Entity Too Large",
+		},
+		{
+			// 不知道长度, 读的时候才发现超过了
+			name:       "chunked",
+			path:       "/user",
+			body:       longName,
+			chunked:    true,
+			wantCode:   http.StatusRequestEntityTooLarge,
+			wantData:   "Request Entity Too Large",
+			wantCalled: true,
+		},
+		{
+			// 路由上放宽了限制
+			name:       "route larger",
+			path:       "/upload",
+			body:       longName,
+			chunked:    true,
+			wantCode:   http.StatusOK,
+			wantData:   strings.Repeat("a", 64),
+			wantCalled: true,
+		},
+		{
+			// 知道长度, 超过了全局的限制, 但是没有超过路由上的限制
+			name:       "route larger content length",
+			path:       "/upload",
+			body:       longName,
+			wantCode:   http.StatusOK,
+			wantData:   strings.Repeat("a", 64),
+			wantCalled: true,
+		},
+		{
+			name:     "route smaller",
+			path:     "/tiny",
+			body:     `{"name":"Tom"}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantData: "Request Entity Too Large",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			called = false
+			logged = 0
+			var body io.Reader = strings.NewReader(tc.body)
+			if tc.chunked {
+				// 包一层, 让 httptest 拿不到长度
+				body = io.MultiReader(bytes.NewBufferString(tc.body))
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, body)
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantData, recorder.Body.String())
+			assert.Equal(t, tc.wantCalled, called)
+			assert.Equal(t, tc.wantCode, logged)
+		})
+	}
+}
+
+func TestServerTimeoutOptions(t *testing.T) {
+	server := NewHTTPServer(
+		ServerWithReadTimeout(time.Second),
+		ServerWithReadHeaderTimeout(2*time.Second),
+		ServerWithWriteTimeout(3*time.Second),
+		ServerWithIdleTimeout(4*time.Second),
+		ServerWithMaxHeaderBytes(1<<10),
+	)
+	assert.Equal(t, time.Second, server.server.ReadTimeout)
+	assert.Equal(t, 2*time.Second, server.server.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, server.server.WriteTimeout)
+	assert.Equal(t, 4*time.Second, server.server.IdleTimeout)
+	assert.Equal(t, 1<<10, server.server.MaxHeaderBytes)
+}
@@ -3,14 +3,19 @@ package web
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"net/url"
-	"strconv"
+	"slices"
 	"sync"
 )
 
 // 解决大多数人的需求
 
+// Context 是从池子里面拿出来的, ServeHTTP 返回之后就会被回收, 给下一个请求用
+// 所以 handler 里面开的 goroutine 不能直接使用 Context, 要用 Copy 复制一份
 type Context struct {
 	Req *http.Request
 
@@ -23,7 +28,10 @@ type Context struct {
 	RespData       []byte
 	RespStatusCode int
 
-	PathParams map[string]string
+	// 路径参数, 和 mi 共用一个底层数组
+	PathParams Params
+	// 路由匹配的结果, 跟着 Context 一起复用
+	mi matchInfo
 
 	queryValues url.Values
 
@@ -32,6 +40,62 @@ type Context struct {
 	tplEngine TemplateEngine
 
 	UserValues map[string]any
+
+	// 没有被限制大小之前的请求体
+	rawBody io.ReadCloser
+	// 当前生效的请求体大小限制, 0 代表不限制
+	bodyLimit int64
+	// 读请求体的时候超过了大小限制
+	bodyTooLarge bool
+
+	// 响应已经直接写出去了(比如说 Stream), flashResp 不需要再写
+	committed bool
+	// 直接写出去的字节数
+	respSize int
+}
+
+// Param 一个路径参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 路径参数, 一个路由的参数不会很多, 用切片比 map 快, 而且可以复用
+type Params []Param
+
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// Copy 复制一份 Context, 给 handler 里面新开的 goroutine 使用
+// 复制出来的 Context 不会被回收, 但是 Resp 在请求结束之后就不能再写了
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Req:            c.Req,
+		Resp:           c.Resp,
+		RespData:       slices.Clone(c.RespData),
+		RespStatusCode: c.RespStatusCode,
+		queryValues:    c.queryValues,
+		MatchedRoute:   c.MatchedRoute,
+		tplEngine:      c.tplEngine,
+		UserValues:     maps.Clone(c.UserValues),
+	}
+	cp.mi.node = c.mi.node
+	cp.mi.pathParams = slices.Clone(c.mi.pathParams)
+	cp.mi.typedParams = slices.Clone(c.mi.typedParams)
+	cp.PathParams = slices.Clone(c.PathParams)
+	return cp
+}
+
+// reset 清理掉上一个请求留下来的数据, 放回池子之前调用
+func (c *Context) reset() {
+	c.mi.reset()
+	*c = Context{mi: c.mi}
 }
 
 func (c *Context) Render(tplName string, data any) error {
@@ -46,18 +110,10 @@ func (c *Context) Render(tplName string, data any) error {
 	return nil
 }
 
+// RespJSON 不能在这里 WriteHeader, 不然 Content-Type 就设置不上了
+// 状态码和数据都是在 flashResp 里面写出去的
 func (c *Context) RespJSON(status int, val any) error {
-	data, err := json.Marshal(val)
-	if err != nil {
-		return err
-	}
-
-	c.Resp.WriteHeader(status)
-	c.Resp.Header().Set("Content-Type", "application/json")
-	//c.Resp.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	c.RespData = data
-	c.RespStatusCode = status
-	return nil
+	return c.render(status, "application/json", val)
 }
 
 func (c *Context) RespJSONOK(val any) error {
@@ -92,7 +148,7 @@ func (c *Context) FormValue(key string) (string, error) {
 	}
 	vals, ok := c.Req.Form[key]
 	if !ok {
-		return "", errors.New("web: key 不存在")
+		return "", ErrKeyNotFound
 	}
 	return vals[0], nil
 }
@@ -105,18 +161,19 @@ func (c *Context) QueryValue(key string) (string, error) {
 
 	// 用户区别不出来是真的有值, 但是值恰好是空字符串
 	// 还是没有值(go 的零值问题)
+	// 要区分的话用 QueryValueV1 的 Exists, 或者判断 ErrKeyNotFound
 
 	vals, ok := c.queryValues[key]
 	if !ok || len(vals) == 0 {
-		return "", errors.New("web: key 不存在")
+		return "", ErrKeyNotFound
 	}
 	return vals[0], nil
 }
 
 func (c *Context) PathValue(key string) (string, error) {
-	val, ok := c.PathParams[key]
+	val, ok := c.PathParams.Get(key)
 	if !ok {
-		return "", errors.New("web: key 不存在")
+		return "", ErrKeyNotFound
 	}
 
 	return val, nil
@@ -124,31 +181,36 @@ func (c *Context) PathValue(key string) (string, error) {
 
 // 返回结构体的好处就是可以给结构体加方法, 就可以连续调用转类型的方法
 func (c *Context) PathValueV1(key string) StringValue {
-	val, ok := c.PathParams[key]
+	val, ok := c.PathParams.Get(key)
 	if !ok {
-		return StringValue{
-			val: "",
-			err: errors.New("web: key 不存在"),
-		}
-	}
-
-	return StringValue{
-		val: val,
-		err: nil,
+		return StringValue{err: ErrKeyNotFound}
 	}
+	return StringValue{val: val, vals: []string{val}}
 }
 
-type StringValue struct {
-	val string
-	err error
+// PathTypedValue 拿到类型约束路由转换好的值
+// 例如 :id<int> 拿到的是 int64, :uid<uuid> 拿到的是 uuid.UUID
+func (c *Context) PathTypedValue(key string) (any, error) {
+	for _, p := range c.mi.typedParams {
+		if p.key == key {
+			return p.val, nil
+		}
+	}
+	return nil, ErrKeyNotFound
 }
 
-func (s StringValue) AsInt64() (int64, error) {
-	if s.err != nil {
-		return 0, s.err
+// PathValueAs 是 PathTypedValue 的泛型版本, 省掉类型断言
+func PathValueAs[T any](c *Context, key string) (T, error) {
+	var t T
+	val, err := c.PathTypedValue(key)
+	if err != nil {
+		return t, err
 	}
-
-	return strconv.ParseInt(s.val, 10, 64)
+	t, ok := val.(T)
+	if !ok {
+		return t, fmt.Errorf("web: key %s 的类型是 %T", key, val)
+	}
+	return t, nil
 }
 
 // 原本的 Context 不是线程安全的, 我们也没必要设计成线程安全
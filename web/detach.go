@@ -0,0 +1,77 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"net/http"
+)
+
+// Detach 复制一份 Context 交给别的 goroutine 跑 handler, 例如超时控制
+// 复制出来的 Context 用 reqCtx 作为请求的 context, 响应写到一个缓冲区里面, 不会碰到原来的 Context 和 Resp
+// 跑完之后用 Merge 把结果合并回来, 超时了就直接丢掉, 这样迟到的写入不会有并发问题
+// 不适合 Stream 和 WebSocket 这种要直接写响应的场景
+func (c *Context) Detach(reqCtx context.Context) *Context {
+	cp := c.Copy()
+	cp.Req = c.Req.WithContext(reqCtx)
+	cp.Resp = &detachedWriter{header: c.Resp.Header().Clone()}
+	cp.rawBody = c.rawBody
+	cp.bodyLimit = c.bodyLimit
+	cp.bodyTooLarge = c.bodyTooLarge
+	// 限制了大小的请求体会回写 bodyTooLarge, 要换成回写到复制出来的 Context 上
+	if lb, ok := c.Req.Body.(*limitedBody); ok {
+		cp.Req.Body = &limitedBody{ctx: cp, body: lb.body}
+	}
+	return cp
+}
+
+// Merge 把 Detach 出去的 Context 的结果合并回来
+// 必须在 child 的 handler 返回之后调用
+func (c *Context) Merge(child *Context) {
+	w, ok := child.Resp.(*detachedWriter)
+	if !ok {
+		panic("web: Merge 只能合并 Detach 出来的 Context")
+	}
+	header := c.Resp.Header()
+	clear(header)
+	maps.Copy(header, w.header)
+
+	c.RespStatusCode = child.RespStatusCode
+	if c.RespStatusCode == 0 {
+		c.RespStatusCode = w.status
+	}
+	// 直接写到 Resp 的数据在前面, 提交过的话 RespData 就不会再写出去了
+	data := w.buf.Bytes()
+	if !child.committed {
+		data = append(data, child.RespData...)
+	}
+	c.RespData = data
+
+	c.MatchedRoute = child.MatchedRoute
+	c.UserValues = child.UserValues
+	c.bodyTooLarge = child.bodyTooLarge
+}
+
+// detachedWriter 缓存 Detach 出来的 Context 直接写到 Resp 的数据
+type detachedWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *detachedWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *detachedWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(p)
+}
+
+func (w *detachedWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
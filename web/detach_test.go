@@ -0,0 +1,45 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext_DetachMerge(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	recorder := httptest.NewRecorder()
+	recorder.Header().Set("X-Parent", "parent")
+	ctx := &Context{Req: req, Resp: recorder, UserValues: map[string]any{"a": 1}}
+
+	type key struct{}
+	child := ctx.Detach(context.WithValue(req.Context(), key{}, "child"))
+	assert.Equal(t, "child", child.Req.Context().Value(key{}))
+	child.Resp.Header().Set("X-Child", "child")
+	child.Resp.Header().Del("X-Parent")
+	_, _ = child.Resp.Write([]byte("hello "))
+	child.RespData = []byte("world")
+	child.UserValues["b"] = 2
+	child.MatchedRoute = "/user"
+
+	// 合并之前不会影响到原来的 Context
+	assert.Equal(t, "parent", recorder.Header().Get("X-Parent"))
+	assert.Empty(t, recorder.Header().Get("X-Child"))
+	assert.Nil(t, ctx.UserValues["b"])
+
+	ctx.Merge(child)
+	assert.Equal(t, http.StatusOK, ctx.RespStatusCode)
+	assert.Equal(t, "hello world", string(ctx.RespData))
+	assert.Equal(t, "child", recorder.Header().Get("X-Child"))
+	assert.Empty(t, recorder.Header().Get("X-Parent"))
+	assert.Equal(t, map[string]any{"a": 1, "b": 2}, ctx.UserValues)
+	assert.Equal(t, "/user", ctx.MatchedRoute)
+	assert.Equal(t, 0, recorder.Body.Len())
+
+	assert.Panics(t, func() {
+		ctx.Merge(ctx)
+	})
+}
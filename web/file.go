@@ -5,8 +5,10 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 )
@@ -70,20 +72,19 @@ type FileDownloader struct {
 
 func (d FileDownloader) Handle() HandleFunc {
 	return func(ctx *Context) {
-		// 用的是 xxx?file=xxx
-		value, err := ctx.QueryValue("file")
+		// 优先用 /download/*file 这种路径参数, 可以下载子目录里面的文件
+		// 没有的话用的是 xxx?file=xxx
+		value, err := ctx.PathValue("file")
+		if err != nil {
+			value, err = ctx.QueryValue("file")
+		}
 		if err != nil {
 			ctx.RespStatusCode = http.StatusBadRequest
 			ctx.RespData = []byte("找不到目标文件")
 			return
 		}
-		value = filepath.Clean(value)
-		dst := filepath.Join(d.Dir, value)
-
 		// 防止相对路径引起攻击者下载了你的系统文件
-		//abs, err := filepath.Abs(dst)
-		//if strings.Contains(dst, d.Dir) {
-		//}
+		dst := joinInDir(d.Dir, value)
 
 		fn := filepath.Base(dst)
 
@@ -165,26 +166,26 @@ func (s *StaticResourceHandler) Handle(ctx *Context) {
 	// 1. 拿到目标文件名
 	// 2. 定位到目标文件, 并且读出来
 	// 3. 返回给前端
+	// 注册成 /static/*file 就可以访问子目录
 	file, err := ctx.PathValue("file")
 	if err != nil {
 		ctx.RespStatusCode = http.StatusBadRequest
 		ctx.RespData = []byte("请求路径不对")
 		return
 	}
+	file = path.Clean("/" + file)
 
 	header := ctx.Resp.Header()
 	// 可能的有文本文件, 图片, 多媒体(音频, 视频)
-	ext := filepath.Ext(file)
+	ext := strings.TrimPrefix(filepath.Ext(file), ".")
 	if data, ok := s.cache.Get(file); ok {
-
-		header.Set("Content-Type", s.extContentTypeMap[ext[1:]])
-		header.Set("Content-Language", strconv.Itoa(len(data)))
+		s.setHeader(header, ext, data)
 		ctx.RespData = data
 		ctx.RespStatusCode = http.StatusOK
 		return
 	}
 
-	dst := filepath.Join(s.dir, file)
+	dst := joinInDir(s.dir, file)
 	data, err := os.ReadFile(dst)
 	if err != nil {
 		ctx.RespStatusCode = http.StatusInternalServerError
@@ -197,9 +198,22 @@ func (s *StaticResourceHandler) Handle(ctx *Context) {
 		s.cache.Add(file, data)
 	}
 
-	header.Set("Content-Type", s.extContentTypeMap[ext[1:]])
-	header.Set("Content-Language", strconv.Itoa(len(data)))
+	s.setHeader(header, ext, data)
 	ctx.RespData = data
 	ctx.RespStatusCode = http.StatusOK
 
 }
+
+// setHeader 不认识的扩展名不设置 Content-Type, 交给 net/http 根据内容判断
+func (s *StaticResourceHandler) setHeader(header http.Header, ext string, data []byte) {
+	if contentType, ok := s.extContentTypeMap[ext]; ok {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+}
+
+// joinInDir 把请求里面的相对路径拼到 dir 下面
+// 先按照绝对路径 Clean 一遍, 这样 ../ 就没办法跳出 dir 了
+func joinInDir(dir string, file string) string {
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+file)))
+}
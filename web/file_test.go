@@ -0,0 +1,72 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticResourceHandler_Handle(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "img", "icons"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "img", "icons", "logo.png"), []byte("logo"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("readme"), 0o644))
+
+	s, err := NewStaticResourceHandler(dir)
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static/*file", s.Handle)
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantData string
+		wantType string
+	}{
+		{
+			name:     "nested",
+			path:     "/static/img/icons/logo.png",
+			wantCode: http.StatusOK,
+			wantData: "logo",
+			wantType: "image/png",
+		},
+		{
+			name:     "no extension",
+			path:     "/static/README",
+			wantCode: http.StatusOK,
+			wantData: "readme",
+		},
+		{
+			// 不能跳出目录
+			name:     "escape",
+			path:     "/static/../../README",
+			wantCode: http.StatusOK,
+			wantData: "readme",
+		},
+		{
+			name:     "not exist",
+			path:     "/static/img/none.png",
+			wantCode: http.StatusInternalServerError,
+			wantData: "服务器错误",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantData, recorder.Body.String())
+			if tc.wantType != "" {
+				assert.Equal(t, tc.wantType, recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RouteGroup 路由分组
+// 同一个前缀下面的路由共享一组中间件, 比如说 /api/v1, /admin
+// 分组中间件挂在前缀对应的节点上, 查找的时候由 findMdls 按层收集
+// 分组中间件只挂在注册过的方法上, 自动应答的 OPTIONS 不会经过它们
+// 分组里面的 CORS 要处理预检请求的话, 单独注册到 OPTIONS 上, 例如 server.Use(http.MethodOptions, "/api/*", cors)
+type RouteGroup struct {
+	server *HTTPServer
+	parent *RouteGroup
+
+	// 完整的前缀, 不以 / 结尾, 根分组为 ""
+	prefix string
+	mdls   []Middleware
+
+	// 分组中间件是按照 HTTP 方法挂到对应的路由树上的
+	// 这里记录已经挂过的方法, 避免重复挂载
+	mounted map[string]struct{}
+}
+
+// Group 创建一个路由分组
+// prefix 必须以 / 开头, 不能以 / 结尾 (除了 "/" 本身)
+// 分组中间件是挂在前缀对应的节点上的, 不是挂在分组上的, 所以同一个前缀下面的路由都会经过它们,
+// 包括别的分组注册的, 和直接用 server.Get 注册的. 例如 server.Group("/api", auth) 之后,
+// server.Group("/api").Get("/public", ...) 和 server.Get("/api/public", ...) 也要经过 auth.
+// 不需要这些中间件的路由要换一个前缀, 例如 /public
+func (h *HTTPServer) Group(prefix string, mdls ...Middleware) *RouteGroup {
+	return newRouteGroup(h, nil, prefix, mdls)
+}
+
+func newRouteGroup(server *HTTPServer, parent *RouteGroup, prefix string, mdls []Middleware) *RouteGroup {
+	if prefix == "" || prefix[0] != '/' {
+		panic(fmt.Sprintf("web: 分组前缀必须以 / 开头 [%s]", prefix))
+	}
+	if prefix != "/" && prefix[len(prefix)-1] == '/' {
+		panic(fmt.Sprintf("web: 分组前缀不能以 / 结尾 [%s]", prefix))
+	}
+	if prefix == "/" {
+		prefix = ""
+	}
+	if parent != nil {
+		prefix = parent.prefix + prefix
+	}
+	return &RouteGroup{
+		server:  server,
+		parent:  parent,
+		prefix:  prefix,
+		mdls:    mdls,
+		mounted: make(map[string]struct{}, 4),
+	}
+}
+
+// Group 在当前分组下面创建子分组
+// 子分组的路由会先经过父分组的中间件, 再经过自己的中间件
+func (g *RouteGroup) Group(prefix string, mdls ...Middleware) *RouteGroup {
+	return newRouteGroup(g.server, g, prefix, mdls)
+}
+
+// Use 给分组下面的某个路径注册中间件
+func (g *RouteGroup) Use(method string, path string, mdls ...Middleware) {
+	g.addRoute(method, path, nil, mdls...)
+}
+
+func (g *RouteGroup) Get(path string, handleFunc HandleFunc) {
+	g.addRoute(http.MethodGet, path, handleFunc)
+}
+
+func (g *RouteGroup) Post(path string, handleFunc HandleFunc) {
+	g.addRoute(http.MethodPost, path, handleFunc)
+}
+
+func (g *RouteGroup) Put(path string, handleFunc HandleFunc) {
+	g.addRoute(http.MethodPut, path, handleFunc)
+}
+
+func (g *RouteGroup) Delete(path string, handleFunc HandleFunc) {
+	g.addRoute(http.MethodDelete, path, handleFunc)
+}
+
+func (g *RouteGroup) Patch(path string, handleFunc HandleFunc) {
+	g.addRoute(http.MethodPatch, path, handleFunc)
+}
+
+func (g *RouteGroup) Head(path string, handleFunc HandleFunc) {
+	g.addRoute(http.MethodHead, path, handleFunc)
+}
+
+func (g *RouteGroup) Options(path string, handleFunc HandleFunc) {
+	g.addRoute(http.MethodOptions, path, handleFunc)
+}
+
+func (g *RouteGroup) Any(path string, handleFunc HandleFunc) {
+	for _, method := range anyMethods {
+		g.addRoute(method, path, handleFunc)
+	}
+}
+
+func (g *RouteGroup) addRoute(method string, path string, handleFunc HandleFunc, mdls ...Middleware) {
+	g.mount(method)
+	g.server.addRoute(method, g.fullPath(path), handleFunc, mdls...)
+}
+
+// mount 把分组中间件挂到 method 对应路由树的前缀节点上
+// 父分组要先挂, 这样执行顺序才是从外到内
+func (g *RouteGroup) mount(method string) {
+	if g.parent != nil {
+		g.parent.mount(method)
+	}
+	if len(g.mdls) == 0 {
+		return
+	}
+	if _, ok := g.mounted[method]; ok {
+		return
+	}
+	g.mounted[method] = struct{}{}
+	g.server.addRoute(method, g.fullPath("/"), nil, g.mdls...)
+}
+
+// fullPath 拼接前缀和路径, path 为 "/" 代表分组前缀本身
+func (g *RouteGroup) fullPath(path string) string {
+	if path == "" || path[0] != '/' {
+		panic(fmt.Sprintf("web: 路径必须以 / 开头 [%s]", path))
+	}
+	if path == "/" {
+		if g.prefix == "" {
+			return "/"
+		}
+		return g.prefix
+	}
+	return g.prefix + path
+}
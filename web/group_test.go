@@ -0,0 +1,183 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteGroup(t *testing.T) {
+	var logs []string
+	mdlOf := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				logs = append(logs, name)
+				next(ctx)
+			}
+		}
+	}
+	handlerOf := func(name string) HandleFunc {
+		return func(ctx *Context) {
+			logs = append(logs, name)
+			ctx.RespStatusCode = http.StatusOK
+			ctx.RespData = []byte(ctx.MatchedRoute)
+		}
+	}
+
+	server := NewHTTPServer()
+	server.Get("/health", handlerOf("health"))
+
+	api := server.Group("/api", mdlOf("api"))
+	api.Get("/", handlerOf("api index"))
+
+	v1 := api.Group("/v1", mdlOf("v1"))
+	v1.Get("/user/:id", handlerOf("user detail"))
+	v1.Put("/user/:id", handlerOf("user update"))
+	v1.Use(http.MethodGet, "/user/:id", mdlOf("user"))
+
+	admin := server.Group("/admin", mdlOf("auth"))
+	admin.Delete("/user/:id", handlerOf("admin delete"))
+	server.Use(http.MethodOptions, "/admin/*", mdlOf("preflight"))
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		wantCode int
+		wantData string
+		wantLogs []string
+	}{
+		{
+			name:     "no group",
+			method:   http.MethodGet,
+			path:     "/health",
+			wantCode: http.StatusOK,
+			wantData: "/health",
+			wantLogs: []string{"health"},
+		},
+		{
+			name:     "group prefix",
+			method:   http.MethodGet,
+			path:     "/api",
+			wantCode: http.StatusOK,
+			wantData: "/api",
+			wantLogs: []string{"api", "api index"},
+		},
+		{
+			name:     "nested group",
+			method:   http.MethodGet,
+			path:     "/api/v1/user/123",
+			wantCode: http.StatusOK,
+			wantData: "/api/v1/user/:id",
+			wantLogs: []string{"api", "v1", "user", "user detail"},
+		},
+		{
+			name:     "nested group other method",
+			method:   http.MethodPut,
+			path:     "/api/v1/user/123",
+			wantCode: http.StatusOK,
+			wantData: "/api/v1/user/:id",
+			wantLogs: []string{"api", "v1", "user update"},
+		},
+		{
+			name:     "sibling group",
+			method:   http.MethodDelete,
+			path:     "/admin/user/123",
+			wantCode: http.StatusOK,
+			wantData: "/admin/user/:id",
+			wantLogs: []string{"auth", "admin delete"},
+		},
+		{
+			// 自动应答的 OPTIONS 不会经过分组的中间件, 例如鉴权
+			name:     "auto options",
+			method:   http.MethodOptions,
+			path:     "/api/v1/user/123",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			// 明确注册在 OPTIONS 上的中间件还是会执行
+			name:     "auto options with middleware",
+			method:   http.MethodOptions,
+			path:     "/admin/user/123",
+			wantCode: http.StatusNoContent,
+			wantLogs: []string{"preflight"},
+		},
+		{
+			name:     "not found",
+			method:   http.MethodGet,
+			path:     "/admin/order/123",
+			wantCode: http.StatusNotFound,
+			wantData: "Not Found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logs = nil
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantData, recorder.Body.String())
+			assert.Equal(t, tc.wantLogs, logs)
+		})
+	}
+}
+
+// 分组中间件挂在前缀的节点上, 同一个前缀下面别的分组和直接注册的路由也会经过它们
+func TestRouteGroup_SharedPrefix(t *testing.T) {
+	var logs []string
+	auth := func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			logs = append(logs, "auth")
+			next(ctx)
+		}
+	}
+	handler := func(ctx *Context) {
+		logs = append(logs, ctx.MatchedRoute)
+	}
+
+	server := NewHTTPServer()
+	server.Group("/api", auth).Get("/user", handler)
+	server.Group("/api").Get("/public", handler)
+	server.Get("/api/health", handler)
+	server.Get("/public", handler)
+
+	testCases := []struct {
+		path     string
+		wantLogs []string
+	}{
+		{path: "/api/user", wantLogs: []string{"auth", "/api/user"}},
+		{path: "/api/public", wantLogs: []string{"auth", "/api/public"}},
+		{path: "/api/health", wantLogs: []string{"auth", "/api/health"}},
+		{path: "/public", wantLogs: []string{"/public"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			logs = nil
+			server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantLogs, logs)
+		})
+	}
+}
+
+func TestRouteGroup_Panic(t *testing.T) {
+	server := NewHTTPServer()
+	assert.Panics(t, func() {
+		server.Group("api")
+	})
+	assert.Panics(t, func() {
+		server.Group("/api/")
+	})
+	assert.Panics(t, func() {
+		server.Group("/api").Get("user", func(ctx *Context) {})
+	})
+
+	// 和直接注册的路由冲突
+	server.Get("/api/user", func(ctx *Context) {})
+	assert.Panics(t, func() {
+		server.Group("/api").Get("/user", func(ctx *Context) {})
+	})
+}
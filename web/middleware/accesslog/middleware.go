@@ -7,6 +7,8 @@ import (
 
 type MiddlewareBuilder struct {
 	logFunc func(log string)
+	// 请求 ID 从这个响应头里面读, requestid 中间件会把请求 ID 写到响应头里面
+	requestIDHeader string
 }
 
 func (m *MiddlewareBuilder) LogFunc(fn func(log string)) *MiddlewareBuilder {
@@ -14,16 +16,34 @@ func (m *MiddlewareBuilder) LogFunc(fn func(log string)) *MiddlewareBuilder {
 	return m
 }
 
+// RequestIDHeader requestid 中间件换了头部的话, 这里也要跟着换, 默认是 X-Request-ID
+func (m *MiddlewareBuilder) RequestIDHeader(name string) *MiddlewareBuilder {
+	m.requestIDHeader = name
+	return m
+}
+
 func (m MiddlewareBuilder) Build() web.Middleware {
+	requestIDHeader := m.requestIDHeader
+	if requestIDHeader == "" {
+		requestIDHeader = "X-Request-ID"
+	}
 	return func(next web.HandleFunc) web.HandleFunc {
 		return func(ctx *web.Context) {
 			// 要记录请求
 			defer func() {
+				var requestID string
+				// 直接调用 ServeHTTP 的时候可能没有 ResponseWriter
+				if ctx.Resp != nil {
+					requestID = ctx.Resp.Header().Get(requestIDHeader)
+				}
 				l := accessLog{
 					Host:       ctx.Req.Host,
 					Route:      ctx.MatchedRoute,
 					HTTPMethod: ctx.Req.Method,
 					Path:       ctx.Req.URL.Path,
+					StatusCode: ctx.RespStatusCode,
+					RespSize:   ctx.RespSize(),
+					RequestID:  requestID,
 				}
 				data, _ := json.Marshal(l)
 				m.logFunc(string(data))
@@ -39,4 +59,8 @@ type accessLog struct {
 	Route      string `json:"route,omitempty"`
 	HTTPMethod string `json:"http_method,omitempty"`
 	Path       string `json:"path,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	RespSize   int    `json:"resp_size,omitempty"`
+	// 用了 requestid 中间件才有
+	RequestID string `json:"request_id,omitempty"`
 }
@@ -3,7 +3,10 @@ package accesslog
 import (
 	"fmt"
 	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/middleware/requestid"
+	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -24,3 +27,37 @@ func TestMiddlewareBuilder_Build(t *testing.T) {
 	}
 	server.ServeHTTP(nil, req)
 }
+
+func TestMiddlewareBuilder_RequestID(t *testing.T) {
+	var log string
+	mdl := (&MiddlewareBuilder{}).LogFunc(func(l string) {
+		log = l
+	}).Build()
+	server := web.NewHTTPServer(web.ServerWithMiddleware(mdl, requestid.NewMiddlewareBuilder().Build()))
+	server.Get("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "user")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	assert.JSONEq(t, `{"host":"example.com","route":"/user","http_method":"GET","path":"/user",
+"status_code":200,"resp_size":4,"request_id":"abc-123"}`, log)
+}
+
+func TestMiddlewareBuilder_RequestIDHeader(t *testing.T) {
+	var log string
+	mdl := (&MiddlewareBuilder{}).LogFunc(func(l string) {
+		log = l
+	}).RequestIDHeader("X-Trace-ID").Build()
+	server := web.NewHTTPServer(web.ServerWithMiddleware(mdl,
+		requestid.NewMiddlewareBuilder().Header("X-Trace-ID").Build()))
+	server.Get("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "user")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("X-Trace-ID", "abc-123")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Contains(t, log, `"request_id":"abc-123"`)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Moty1999/web/web"
+)
+
+// KeyStore 根据 API key 找到它的名字, 也就是 Principal 的 Subject
+// 找不到的话返回 ErrInvalidCredentials
+type KeyStore interface {
+	Lookup(ctx context.Context, key string) (string, error)
+}
+
+// APIKeyAuthenticator 从头部读 API key, 默认是 X-API-Key
+type APIKeyAuthenticator struct {
+	store  KeyStore
+	header string
+	query  string
+}
+
+type APIKeyOption func(a *APIKeyAuthenticator)
+
+func APIKeyWithHeader(name string) APIKeyOption {
+	return func(a *APIKeyAuthenticator) {
+		a.header = name
+	}
+}
+
+// APIKeyWithQuery 头部里面没有的话, 从查询参数里面读
+// 查询参数会被记到各种日志里面, 能不用就不用
+func APIKeyWithQuery(name string) APIKeyOption {
+	return func(a *APIKeyAuthenticator) {
+		a.query = name
+	}
+}
+
+func NewAPIKeyAuthenticator(store KeyStore, opts ...APIKeyOption) *APIKeyAuthenticator {
+	res := &APIKeyAuthenticator{
+		store:  store,
+		header: "X-API-Key",
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx *web.Context) (*Principal, error) {
+	key := ctx.Req.Header.Get(a.header)
+	if key == "" && a.query != "" {
+		key = ctx.Req.URL.Query().Get(a.query)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	name, err := a.store.Lookup(ctx.Req.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: name, Scheme: "apikey"}, nil
+}
+
+// 存的是 key 的哈希, 这样内存里面没有明文, 查找的耗时也和 key 的内容无关
+type keyHashes map[[32]byte]string
+
+func hashKeys(keys map[string]string) keyHashes {
+	res := make(keyHashes, len(keys))
+	for key, name := range keys {
+		res[sha256.Sum256([]byte(key))] = name
+	}
+	return res
+}
+
+// StaticKeys 固定的 API key, key 是 API key, value 是它的名字
+type StaticKeys struct {
+	keys keyHashes
+}
+
+func NewStaticKeys(keys map[string]string) *StaticKeys {
+	return &StaticKeys{keys: hashKeys(keys)}
+}
+
+func (s *StaticKeys) Lookup(ctx context.Context, key string) (string, error) {
+	name, ok := s.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return "", fmt.Errorf("%w: 未知的 API key", ErrInvalidCredentials)
+	}
+	return name, nil
+}
+
+// RotatingKeys 可以在运行期间更换的 API key
+// 换了之后旧的 key 还可以用一段时间, 给客户端留出切换的时间
+type RotatingKeys struct {
+	mutex    sync.RWMutex
+	current  keyHashes
+	previous keyHashes
+	// 旧的 key 到这个时间点就不能用了
+	previousUntil time.Time
+
+	now func() time.Time
+}
+
+func NewRotatingKeys(keys map[string]string) *RotatingKeys {
+	return &RotatingKeys{
+		current: hashKeys(keys),
+		now:     time.Now,
+	}
+}
+
+// Rotate 换成新的 key, 旧的 key 在 grace 时间之内还有效
+// 上一次换下来的 key 会被直接丢掉
+func (r *RotatingKeys) Rotate(keys map[string]string, grace time.Duration) {
+	hashes := hashKeys(keys)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.previous = r.current
+	r.previousUntil = r.now().Add(grace)
+	r.current = hashes
+}
+
+func (r *RotatingKeys) Lookup(ctx context.Context, key string) (string, error) {
+	h := sha256.Sum256([]byte(key))
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if name, ok := r.current[h]; ok {
+		return name, nil
+	}
+	if name, ok := r.previous[h]; ok && r.now().Before(r.previousUntil) {
+		return name, nil
+	}
+	return "", fmt.Errorf("%w: 未知的 API key", ErrInvalidCredentials)
+}
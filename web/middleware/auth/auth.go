@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/Moty1999/web/web"
+)
+
+var (
+	// ErrNoCredentials 请求里面没有这种认证方式需要的信息, 中间件会接着尝试下一个 Authenticator
+	ErrNoCredentials = errors.New("auth: 没有认证信息")
+	// ErrInvalidCredentials 有认证信息但是不对, 中间件直接返回 401
+	// 具体的原因用 fmt.Errorf("%w: ...", ErrInvalidCredentials) 包装起来
+	ErrInvalidCredentials = errors.New("auth: 认证信息无效")
+)
+
+// Authenticator 从请求里面认证出用户是谁
+// 没有认证信息返回 ErrNoCredentials, 认证失败返回 ErrInvalidCredentials
+// 其它的错误, 例如查数据库出错了, 中间件会返回 500
+type Authenticator interface {
+	Authenticate(ctx *web.Context) (*Principal, error)
+}
+
+// Challenger 认证失败的时候, 告诉客户端应该怎么认证, 也就是 WWW-Authenticate 头部
+type Challenger interface {
+	Challenge() string
+}
+
+// Principal 认证出来的用户
+type Principal struct {
+	// Subject 用户名, API key 的名字, 或者 JWT 的 sub
+	Subject string
+	// Scheme 认证方式, basic, apikey 或者 jwt
+	Scheme string
+	// Claims JWT 里面的所有 claims, 别的认证方式为 nil
+	Claims map[string]any
+	// Roles 和 Permissions 给 authz 用的
+	// JWT 从 roles, permissions 和 scope 里面读, 别的认证方式要自己在 authz 里面补上
+	Roles       []string
+	Permissions []string
+}
+
+// 放在 ctx.UserValues 里面的 key
+const principalKey = "auth_principal"
+
+// PrincipalOf 拿到认证出来的用户, 没有经过认证的话第二个返回值为 false
+func PrincipalOf(ctx *web.Context) (*Principal, bool) {
+	p, ok := ctx.UserValues[principalKey].(*Principal)
+	return p, ok
+}
+
+// SetPrincipal 自己实现认证逻辑, 或者测试的时候用
+func SetPrincipal(ctx *web.Context, p *Principal) {
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 4)
+	}
+	ctx.UserValues[principalKey] = p
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+
+	"github.com/Moty1999/web/web"
+)
+
+// BasicVerifier 校验用户名和密码, 例如查数据库比对密码的哈希
+type BasicVerifier func(ctx context.Context, username, password string) (bool, error)
+
+// BasicAuthenticator HTTP Basic 认证, 一定要配合 HTTPS 使用
+type BasicAuthenticator struct {
+	realm  string
+	verify BasicVerifier
+}
+
+func NewBasicAuthenticator(realm string, verify BasicVerifier) *BasicAuthenticator {
+	return &BasicAuthenticator{
+		realm:  realm,
+		verify: verify,
+	}
+}
+
+func (b *BasicAuthenticator) Authenticate(ctx *web.Context) (*Principal, error) {
+	username, password, ok := ctx.Req.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	ok, err := b.verify(ctx.Req.Context(), username, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: 用户名或者密码错误", ErrInvalidCredentials)
+	}
+	return &Principal{Subject: username, Scheme: "basic"}, nil
+}
+
+func (b *BasicAuthenticator) Challenge() string {
+	return "Basic realm=" + strconv.Quote(b.realm) + `, charset="UTF-8"`
+}
+
+// BasicUsers 固定的用户名和密码, 适合内部的管理接口
+// 比较的是哈希, 这样耗时和密码的内容无关
+func BasicUsers(users map[string]string) BasicVerifier {
+	hashes := make(map[string][32]byte, len(users))
+	for username, password := range users {
+		hashes[username] = sha256.Sum256([]byte(password))
+	}
+	return func(ctx context.Context, username, password string) (bool, error) {
+		want, ok := hashes[username]
+		got := sha256.Sum256([]byte(password))
+		return ok && subtle.ConstantTimeCompare(want[:], got[:]) == 1, nil
+	}
+}
@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// JWKS 一组公钥, 格式参考 RFC 7517, 只支持 RSA 和 P-256 的 EC 公钥
+type JWKS struct {
+	keys []jwksKey
+}
+
+type jwksKey struct {
+	kid string
+	alg string
+	key any
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS 解析 JWKS, 不认识的和不合法的 key 会被跳过, 一个能用的都没有才返回 error
+// 这样认证服务发布了一个有问题的 key, 也不会影响其它的 key
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("auth: JWKS 格式不对 %w", err)
+	}
+	res := &JWKS{keys: make([]jwksKey, 0, len(set.Keys))}
+	var errs []error
+	for _, k := range set.Keys {
+		// 用来加密的 key 不能用来验签
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var (
+			key any
+			alg string
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaKey()
+			alg = RS256
+		case "EC":
+			key, err = k.ecKey()
+			alg = ES256
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key %q 不对 %w", k.Kid, err))
+			continue
+		}
+		if k.Alg != "" && k.Alg != alg {
+			continue
+		}
+		res.keys = append(res.keys, jwksKey{kid: k.Kid, alg: alg, key: key})
+	}
+	if len(res.keys) == 0 {
+		if len(errs) == 0 {
+			return nil, errors.New("auth: JWKS 里面没有能用的 key")
+		}
+		return nil, fmt.Errorf("auth: JWKS 里面没有能用的 key %w", errors.Join(errs...))
+	}
+	return res, nil
+}
+
+// LoadJWKSFile 从文件里面读 JWKS
+func LoadJWKSFile(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+func (k jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || n.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA 公钥不合法")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jwk) ecKey() (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("不支持的曲线 %s", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("EC 公钥长度不对")
+	}
+	// 用 ecdh 检查一下点是不是在曲线上
+	point := append(append([]byte{4}, x...), y...)
+	if _, err = ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("缺少参数")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// Key 按照 kid 找, token 里面没有 kid 的话, 用第一个算法对得上的
+func (j *JWKS) Key(ctx context.Context, kid, alg string) (any, error) {
+	for _, k := range j.keys {
+		if k.alg == alg && (kid == "" || k.kid == kid) {
+			return k.key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: 找不到 key %q", ErrInvalidCredentials, kid)
+}
+
+func (j *JWKS) has(kid, alg string) bool {
+	_, err := j.Key(context.Background(), kid, alg)
+	return err == nil
+}
+
+// RemoteJWKS 从 URL 加载 JWKS, 例如本机上的认证服务暴露的 /.well-known/jwks.json
+// 定期刷新, 碰到不认识的 kid 也会刷新一下, 这样认证服务换了 key 也不用重启
+type RemoteJWKS struct {
+	url    string
+	client *http.Client
+	// 多久刷新一次
+	refresh time.Duration
+	// 两次刷新之间至少隔多久, 防止有人用乱七八糟的 kid 让我们一直去拉
+	minRefresh time.Duration
+
+	mutex     sync.Mutex
+	jwks      *JWKS
+	fetchedAt time.Time
+	// 上一次尝试拉取的时间, 不管成功没有
+	attemptedAt time.Time
+	// 上一次拉取的错误, 一次都没有拉成功过的时候返回给调用者
+	err error
+	// 正在拉取的时候不为 nil, 拉完了会关掉, 同一时刻只有一个请求去拉
+	fetching chan struct{}
+
+	now func() time.Time
+}
+
+type RemoteJWKSOption func(r *RemoteJWKS)
+
+func RemoteJWKSWithClient(client *http.Client) RemoteJWKSOption {
+	return func(r *RemoteJWKS) {
+		r.client = client
+	}
+}
+
+// RemoteJWKSWithRefresh 默认十分钟刷新一次, 碰到不认识的 kid 最快一分钟刷新一次
+func RemoteJWKSWithRefresh(refresh, minRefresh time.Duration) RemoteJWKSOption {
+	return func(r *RemoteJWKS) {
+		r.refresh = refresh
+		r.minRefresh = minRefresh
+	}
+}
+
+func NewRemoteJWKS(url string, opts ...RemoteJWKSOption) *RemoteJWKS {
+	res := &RemoteJWKS{
+		url:        url,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		refresh:    10 * time.Minute,
+		minRefresh: time.Minute,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// Key 拉取的时候不持有锁, 别的请求还是可以用旧的 key
+// 同时有多个请求要拉的话, 只有一个去拉, 其它的等它拉完再检查一次
+func (r *RemoteJWKS) Key(ctx context.Context, kid, alg string) (any, error) {
+	for {
+		r.mutex.Lock()
+		if done := r.fetching; done != nil {
+			jwks := r.jwks
+			r.mutex.Unlock()
+			// 旧的里面有就直接用旧的, 不用等
+			if jwks != nil && jwks.has(kid, alg) {
+				return jwks.Key(ctx, kid, alg)
+			}
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		now := r.now()
+		if !r.needFetch(kid, alg, now) {
+			jwks, err := r.jwks, r.err
+			r.mutex.Unlock()
+			return keyOf(ctx, jwks, err, kid, alg)
+		}
+		done := make(chan struct{})
+		r.fetching = done
+		r.attemptedAt = now
+		r.mutex.Unlock()
+
+		// 拉回来的结果是大家共用的, 不能因为这个请求被取消了就失败
+		jwks, err := r.fetch(context.WithoutCancel(ctx))
+
+		r.mutex.Lock()
+		r.err = err
+		if err == nil {
+			r.jwks = jwks
+			r.fetchedAt = now
+		}
+		// 刷新失败的话继续用旧的
+		jwks, err = r.jwks, r.err
+		r.fetching = nil
+		close(done)
+		r.mutex.Unlock()
+		return keyOf(ctx, jwks, err, kid, alg)
+	}
+}
+
+// needFetch 两次尝试之间至少隔 minRefresh, 拉取失败了也一样, 即便一次都没有拉成功过
+func (r *RemoteJWKS) needFetch(kid, alg string, now time.Time) bool {
+	if !r.attemptedAt.IsZero() && now.Sub(r.attemptedAt) < r.minRefresh {
+		return false
+	}
+	if r.jwks == nil {
+		return true
+	}
+	return now.Sub(r.fetchedAt) >= r.refresh || !r.jwks.has(kid, alg)
+}
+
+func keyOf(ctx context.Context, jwks *JWKS, err error, kid, alg string) (any, error) {
+	if jwks == nil {
+		return nil, fmt.Errorf("auth: 还没有拉到 JWKS %w", err)
+	}
+	return jwks.Key(ctx, kid, alg)
+}
+
+func (r *RemoteJWKS) fetch(ctx context.Context) (*JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: 拉取 JWKS 失败, 响应码 %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
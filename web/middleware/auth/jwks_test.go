@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"alg": "ES256",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+func jwksJSON(t *testing.T, keys ...map[string]string) []byte {
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	data := jwksJSON(t, rsaJWK("rsa", &rsaKey.PublicKey), ecJWK("ec", &ecKey.PublicKey),
+		// 不认识的和用来加密的都跳过
+		map[string]string{"kty": "oct", "kid": "oct", "k": "c2VjcmV0"},
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc"})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	jwks, err := LoadJWKSFile(path)
+	require.NoError(t, err)
+	assert.Len(t, jwks.keys, 2)
+
+	key, err := jwks.Key(context.Background(), "rsa", RS256)
+	require.NoError(t, err)
+	assert.True(t, rsaKey.PublicKey.Equal(key))
+	key, err = jwks.Key(context.Background(), "ec", ES256)
+	require.NoError(t, err)
+	assert.True(t, ecKey.PublicKey.Equal(key))
+	_, err = jwks.Key(context.Background(), "rsa", ES256)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// 点不在曲线上
+	bad := ecJWK("bad", &ecKey.PublicKey)
+	bad["y"] = bad["x"]
+	_, err = ParseJWKS(jwksJSON(t, bad))
+	assert.Error(t, err)
+
+	// RSA 的 key 太短
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = ParseJWKS(jwksJSON(t, rsaJWK("small", &small.PublicKey)))
+	assert.Error(t, err)
+
+	// 有问题的 key 跳过, 其它的还能用
+	jwks, err = ParseJWKS(jwksJSON(t, bad, rsaJWK("small", &small.PublicKey), rsaJWK("rsa", &rsaKey.PublicKey)))
+	require.NoError(t, err)
+	assert.Len(t, jwks.keys, 1)
+	_, err = jwks.Key(context.Background(), "rsa", RS256)
+	assert.NoError(t, err)
+	_, err = jwks.Key(context.Background(), "small", RS256)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// 一个 key 都没有
+	_, err = ParseJWKS(jwksJSON(t))
+	assert.Error(t, err)
+
+	_, err = ParseJWKS([]byte("abc"))
+	assert.Error(t, err)
+	_, err = LoadJWKSFile(filepath.Join(t.TempDir(), "none.json"))
+	assert.Error(t, err)
+}
+
+func TestRemoteJWKS(t *testing.T) {
+	key1, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	key2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	var data atomic.Value
+	data.Store(jwksJSON(t, ecJWK("k1", &key1.PublicKey)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write(data.Load().([]byte))
+	}))
+	defer server.Close()
+
+	now := time.Unix(1700000000, 0)
+	jwks := NewRemoteJWKS(server.URL, RemoteJWKSWithRefresh(time.Hour, time.Minute))
+	jwks.now = func() time.Time { return now }
+
+	_, err = jwks.Key(context.Background(), "k1", ES256)
+	require.NoError(t, err)
+	_, err = jwks.Key(context.Background(), "k1", ES256)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// 认证服务换了 key, 一分钟之内不会重新拉
+	data.Store(jwksJSON(t, ecJWK("k1", &key1.PublicKey), ecJWK("k2", &key2.PublicKey)))
+	_, err = jwks.Key(context.Background(), "k2", ES256)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	now = now.Add(time.Minute)
+	key, err := jwks.Key(context.Background(), "k2", ES256)
+	require.NoError(t, err)
+	assert.True(t, key2.PublicKey.Equal(key))
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// 刷新失败的话继续用旧的
+	server.Close()
+	now = now.Add(time.Hour)
+	_, err = jwks.Key(context.Background(), "k1", ES256)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// 第一次就拉不到
+	_, err = NewRemoteJWKS(server.URL).Key(context.Background(), "k1", ES256)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestRemoteJWKS_Failed(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	var ok atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if !ok.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(jwksJSON(t, ecJWK("k1", &key.PublicKey)))
+	}))
+	defer server.Close()
+
+	now := time.Unix(1700000000, 0)
+	jwks := NewRemoteJWKS(server.URL, RemoteJWKSWithRefresh(time.Hour, time.Minute))
+	jwks.now = func() time.Time { return now }
+
+	// 一次都没有拉成功过, 也要隔 minRefresh 才会再拉
+	for i := 0; i < 3; i++ {
+		_, err = jwks.Key(context.Background(), "k1", ES256)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+
+	ok.Store(true)
+	now = now.Add(time.Minute)
+	_, err = jwks.Key(context.Background(), "k1", ES256)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestRemoteJWKS_Concurrent(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		_, _ = w.Write(jwksJSON(t, ecJWK("k1", &key.PublicKey)))
+	}))
+	defer server.Close()
+	jwks := NewRemoteJWKS(server.URL)
+
+	// 同时来的请求只会拉一次, 都拿到同一个结果
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = jwks.Key(context.Background(), "k1", ES256)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// 正在拉的时候, 旧的里面有的 key 直接用, 没有的要等, 被取消了就不等了
+	jwks.mutex.Lock()
+	jwks.fetching = make(chan struct{})
+	jwks.mutex.Unlock()
+	_, err = jwks.Key(context.Background(), "k1", ES256)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = jwks.Key(ctx, "k2", ES256)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Moty1999/web/web"
+)
+
+// 支持的签名算法
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// KeySet 根据 JWT 头部的 kid 和 alg 找到验签用的 key
+// HS256 返回 []byte, RS256 返回 *rsa.PublicKey, ES256 返回 *ecdsa.PublicKey
+// 找不到的话返回 ErrInvalidCredentials
+type KeySet interface {
+	Key(ctx context.Context, kid, alg string) (any, error)
+}
+
+// HMACKey HS256 用的密钥, 不管 kid 是什么都用它
+type HMACKey []byte
+
+func (k HMACKey) Key(ctx context.Context, kid, alg string) (any, error) {
+	if alg != HS256 {
+		return nil, fmt.Errorf("%w: HMAC 密钥不能验证 %s", ErrInvalidCredentials, alg)
+	}
+	return []byte(k), nil
+}
+
+// JWTAuthenticator 验证 Authorization: Bearer 里面的 JWT
+type JWTAuthenticator struct {
+	keys       KeySet
+	algorithms []string
+	issuer     string
+	audience   []string
+	// 允许的时钟误差, 校验 exp 和 nbf 的时候用
+	skew time.Duration
+
+	now func() time.Time
+}
+
+type JWTOption func(a *JWTAuthenticator)
+
+// JWTWithAlgorithms 只接受这些算法, 默认是 HS256, RS256, ES256 都接受
+// 用 HMACKey 之外的 KeySet 的时候, 最好去掉 HS256
+func JWTWithAlgorithms(algs ...string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.algorithms = algs
+	}
+}
+
+// JWTWithIssuer iss 必须是这个
+func JWTWithIssuer(iss string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.issuer = iss
+	}
+}
+
+// JWTWithAudience aud 里面至少要有一个是这里面的
+func JWTWithAudience(aud ...string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.audience = aud
+	}
+}
+
+// JWTWithSkew 允许的时钟误差, 默认一分钟
+func JWTWithSkew(skew time.Duration) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.skew = skew
+	}
+}
+
+func NewJWTAuthenticator(keys KeySet, opts ...JWTOption) *JWTAuthenticator {
+	res := &JWTAuthenticator{
+		keys:       keys,
+		algorithms: []string{HS256, RS256, ES256},
+		skew:       time.Minute,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx *web.Context) (*Principal, error) {
+	token, ok := bearerToken(ctx.Req.Header.Get("Authorization"))
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.Verify(ctx.Req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	return &Principal{
+		Subject:     sub,
+		Scheme:      "jwt",
+		Claims:      claims,
+		Roles:       stringsClaim(claims, "roles"),
+		Permissions: append(stringsClaim(claims, "permissions"), stringsClaim(claims, "scope")...),
+	}, nil
+}
+
+func (a *JWTAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+func bearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify 验证签名和 exp, nbf, iss, aud, 返回所有的 claims
+// 数字类型的 claim 是 json.Number
+func (a *JWTAuthenticator) Verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: JWT 格式不对", ErrInvalidCredentials)
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	// 一定要检查算法, 不然 alg: none 或者拿公钥当 HMAC 密钥都能伪造
+	if !slices.Contains(a.algorithms, header.Alg) {
+		return nil, fmt.Errorf("%w: 不支持的算法 %q", ErrInvalidCredentials, header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: 签名格式不对", ErrInvalidCredentials)
+	}
+	key, err := a.keys.Key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err = a.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, val any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("%w: JWT 格式不对", ErrInvalidCredentials)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(val); err != nil {
+		return fmt.Errorf("%w: JWT 格式不对", ErrInvalidCredentials)
+	}
+	return nil
+}
+
+var errSignature = fmt.Errorf("%w: 签名不对", ErrInvalidCredentials)
+
+func verifySignature(alg string, key any, signed string, sig []byte) error {
+	hash := sha256.Sum256([]byte(signed))
+	// key 的类型要和算法对得上
+	switch k := key.(type) {
+	case []byte:
+		if alg != HS256 {
+			break
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errSignature
+		}
+		return nil
+	case *rsa.PublicKey:
+		if alg != RS256 {
+			break
+		}
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig) != nil {
+			return errSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != ES256 || k.Curve.Params().BitSize != 256 {
+			break
+		}
+		// JWT 里面的 ECDSA 签名是定长的 r 和 s 拼起来的, 不是 ASN.1
+		if len(sig) != 64 {
+			return errSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, hash[:], r, s) {
+			return errSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: key 和算法 %s 不匹配", ErrInvalidCredentials, alg)
+}
+
+func (a *JWTAuthenticator) validate(claims map[string]any) error {
+	now := a.now()
+	if exp, ok, err := timeClaim(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(a.skew)) {
+		return fmt.Errorf("%w: token 过期了", ErrInvalidCredentials)
+	}
+	if nbf, ok, err := timeClaim(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(a.skew).Before(nbf) {
+		return fmt.Errorf("%w: token 还没有生效", ErrInvalidCredentials)
+	}
+	if a.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.issuer {
+			return fmt.Errorf("%w: iss 不对", ErrInvalidCredentials)
+		}
+	}
+	if len(a.audience) > 0 && !slices.ContainsFunc(audienceOf(claims), func(aud string) bool {
+		return slices.Contains(a.audience, aud)
+	}) {
+		return fmt.Errorf("%w: aud 不对", ErrInvalidCredentials)
+	}
+	return nil
+}
+
+// timeClaim 读 exp, nbf 这种秒级时间戳
+func timeClaim(claims map[string]any, name string) (time.Time, bool, error) {
+	val, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	num, ok := val.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("%w: %s 不是数字", ErrInvalidCredentials, name)
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: %s 不是数字", ErrInvalidCredentials, name)
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true, nil
+}
+
+// audienceOf aud 可以是字符串, 也可以是字符串数组
+func audienceOf(claims map[string]any) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		return stringsOf(aud)
+	}
+	return nil
+}
+
+// stringsClaim 读字符串数组, 或者 OAuth2 scope 那种空格分隔的字符串
+func stringsClaim(claims map[string]any, name string) []string {
+	switch val := claims[name].(type) {
+	case string:
+		return strings.Fields(val)
+	case []any:
+		return stringsOf(val)
+	}
+	return nil
+}
+
+func stringsOf(vals []any) []string {
+	res := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if s, ok := v.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
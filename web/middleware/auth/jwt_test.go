@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signToken 测试用的签发 JWT
+func signToken(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	hash := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case nil:
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTAuthenticator_Verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("secret")
+
+	now := time.Unix(1700000000, 0)
+	claims := func(kvs ...any) map[string]any {
+		res := map[string]any{"sub": "tom", "iss": "auth", "aud": "web", "exp": now.Add(time.Hour).Unix()}
+		for i := 0; i < len(kvs); i += 2 {
+			if kvs[i+1] == nil {
+				delete(res, kvs[i].(string))
+				continue
+			}
+			res[kvs[i].(string)] = kvs[i+1]
+		}
+		return res
+	}
+	jwks := &JWKS{keys: []jwksKey{
+		{kid: "rsa", alg: RS256, key: &rsaKey.PublicKey},
+		{kid: "ec", alg: ES256, key: &ecKey.PublicKey},
+	}}
+	opts := []JWTOption{JWTWithIssuer("auth"), JWTWithAudience("web", "admin"), JWTWithSkew(time.Minute)}
+
+	testCases := []struct {
+		name    string
+		keys    KeySet
+		opts    []JWTOption
+		token   string
+		wantSub string
+		wantErr bool
+	}{
+		{
+			name:    "HS256",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims()),
+			wantSub: "tom",
+		},
+		{
+			name:    "RS256",
+			keys:    jwks,
+			token:   signToken(t, RS256, "rsa", rsaKey, claims()),
+			wantSub: "tom",
+		},
+		{
+			name:    "ES256",
+			keys:    jwks,
+			token:   signToken(t, ES256, "ec", ecKey, claims()),
+			wantSub: "tom",
+		},
+		{
+			name:    "ES256 without kid",
+			keys:    jwks,
+			token:   signToken(t, ES256, "", ecKey, claims()),
+			wantSub: "tom",
+		},
+		{
+			name:    "wrong secret",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", []byte("other"), claims()),
+			wantErr: true,
+		},
+		{
+			name:    "wrong kid",
+			keys:    jwks,
+			token:   signToken(t, RS256, "ec", rsaKey, claims()),
+			wantErr: true,
+		},
+		{
+			name:    "alg none",
+			keys:    HMACKey(secret),
+			token:   signToken(t, "none", "", nil, claims()),
+			wantErr: true,
+		},
+		{
+			name:    "alg not allowed",
+			keys:    HMACKey(secret),
+			opts:    []JWTOption{JWTWithAlgorithms(RS256)},
+			token:   signToken(t, HS256, "", secret, claims()),
+			wantErr: true,
+		},
+		{
+			name:    "tampered",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims())[:10] + "x" + signToken(t, HS256, "", secret, claims())[11:],
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			keys:    HMACKey(secret),
+			token:   "abc.def",
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("exp", now.Add(-2*time.Minute).Unix())),
+			wantErr: true,
+		},
+		{
+			name:    "expired within skew",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("exp", now.Add(-30*time.Second).Unix())),
+			wantSub: "tom",
+		},
+		{
+			name:    "not before",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("nbf", now.Add(2*time.Minute).Unix())),
+			wantErr: true,
+		},
+		{
+			name:    "not before within skew",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("nbf", now.Add(30*time.Second).Unix())),
+			wantSub: "tom",
+		},
+		{
+			name:    "exp not number",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("exp", "tomorrow")),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("iss", "other")),
+			wantErr: true,
+		},
+		{
+			name:    "audience array",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("aud", []string{"other", "admin"})),
+			wantSub: "tom",
+		},
+		{
+			name:    "wrong audience",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("aud", []string{"other"})),
+			wantErr: true,
+		},
+		{
+			name:    "no audience",
+			keys:    HMACKey(secret),
+			token:   signToken(t, HS256, "", secret, claims("aud", nil)),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewJWTAuthenticator(tc.keys, append(opts, tc.opts...)...)
+			a.now = func() time.Time { return now }
+			res, err := a.Verify(context.Background(), tc.token)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantSub, res["sub"])
+		})
+	}
+}
+
+// HS256 的 token 不能拿 RSA 公钥当密钥验过去
+func TestVerifySignature_keyMismatch(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	err = verifySignature(HS256, &rsaKey.PublicKey, "a.b", []byte("sig"))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	err = verifySignature(RS256, []byte("secret"), "a.b", []byte("sig"))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestJWTAuthenticator_Authenticate(t *testing.T) {
+	secret := []byte("secret")
+	server := web.NewHTTPServer()
+	server.Get("/user", func(ctx *web.Context) {
+		p, _ := PrincipalOf(ctx)
+		ctx.RespString(http.StatusOK, fmt.Sprintf("%s:%s:%v:%v", p.Scheme, p.Subject, p.Roles, p.Permissions))
+	})
+	server.Use(http.MethodGet, "/user", NewMiddlewareBuilder(NewJWTAuthenticator(HMACKey(secret))).Build())
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, HS256, "", secret,
+		map[string]any{"sub": "tom", "roles": []string{"admin"}, "permissions": []string{"user:write"},
+			"scope": "user:read order:read", "exp": time.Now().Add(time.Hour).Unix()}))
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "jwt:tom:[admin]:[user:write user:read order:read]", recorder.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Basic dG9tOjEyMzQ1Ng==")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Moty1999/web/web"
+)
+
+// MiddlewareBuilder 按照顺序尝试每一个 Authenticator, 第一个认证成功的生效
+// 一般注册在需要认证的路由或者分组上, 例如 server.Use(http.MethodGet, "/api/*", mdl)
+// 里面个别不需要认证的路由用 SkipRoutes 排除掉
+type MiddlewareBuilder struct {
+	authenticators []Authenticator
+	skipRoutes     map[string]struct{}
+	skipFunc       func(ctx *web.Context) bool
+	optional       bool
+	logFunc        func(err error)
+}
+
+func NewMiddlewareBuilder(authenticators ...Authenticator) *MiddlewareBuilder {
+	if len(authenticators) == 0 {
+		panic("web: auth 至少需要一个 Authenticator")
+	}
+	return &MiddlewareBuilder{
+		authenticators: authenticators,
+		skipRoutes:     make(map[string]struct{}, 4),
+		logFunc: func(err error) {
+			fmt.Printf("auth: 认证出错 %v\n", err)
+		},
+	}
+}
+
+// SkipRoutes 跳过这些路由, 用的是注册的路由, 例如 /api/login, /api/user/:id
+// 拿不到命中的路由的时候, 按照请求路径来比较
+func (m *MiddlewareBuilder) SkipRoutes(routes ...string) *MiddlewareBuilder {
+	for _, route := range routes {
+		m.skipRoutes[route] = struct{}{}
+	}
+	return m
+}
+
+// SkipFunc 返回 true 的请求不认证
+func (m *MiddlewareBuilder) SkipFunc(fn func(ctx *web.Context) bool) *MiddlewareBuilder {
+	m.skipFunc = fn
+	return m
+}
+
+// Optional 没有认证信息的请求也放过去, 但是认证信息不对的还是返回 401
+// 适合登录和不登录看到的东西不一样的接口
+func (m *MiddlewareBuilder) Optional() *MiddlewareBuilder {
+	m.optional = true
+	return m
+}
+
+func (m *MiddlewareBuilder) LogFunc(fn func(err error)) *MiddlewareBuilder {
+	m.logFunc = fn
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			if m.skip(ctx) {
+				next(ctx)
+				return
+			}
+			for _, a := range m.authenticators {
+				p, err := a.Authenticate(ctx)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if errors.Is(err, ErrInvalidCredentials) {
+					m.unauthorized(ctx)
+					return
+				}
+				if err != nil {
+					m.logFunc(err)
+					ctx.RespStatusCode = http.StatusInternalServerError
+					ctx.RespData = []byte("Internal Server Error")
+					return
+				}
+				SetPrincipal(ctx, p)
+				next(ctx)
+				return
+			}
+			if m.optional {
+				next(ctx)
+				return
+			}
+			m.unauthorized(ctx)
+		}
+	}
+}
+
+func (m MiddlewareBuilder) skip(ctx *web.Context) bool {
+	route := ctx.MatchedRoute
+	if route == "" {
+		// 还没匹配到路由, 例如作为全局中间件, 就退回到请求路径
+		route = ctx.Req.URL.Path
+	}
+	if _, ok := m.skipRoutes[route]; ok {
+		return true
+	}
+	return m.skipFunc != nil && m.skipFunc(ctx)
+}
+
+func (m MiddlewareBuilder) unauthorized(ctx *web.Context) {
+	header := ctx.Resp.Header()
+	for _, a := range m.authenticators {
+		if c, ok := a.(Challenger); ok {
+			header.Add("WWW-Authenticate", c.Challenge())
+		}
+	}
+	ctx.RespStatusCode = http.StatusUnauthorized
+	ctx.RespData = []byte("Unauthorized")
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web"
+	"github.com/stretchr/testify/assert"
+)
+
+type errAuthenticator struct{}
+
+func (errAuthenticator) Authenticate(ctx *web.Context) (*Principal, error) {
+	return nil, errors.New("mock error")
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	basic := NewBasicAuthenticator("admin", BasicUsers(map[string]string{"tom": "123456"}))
+	apiKey := NewAPIKeyAuthenticator(NewStaticKeys(map[string]string{"key1": "service-a"}),
+		APIKeyWithQuery("api_key"))
+
+	server := web.NewHTTPServer()
+	handler := func(ctx *web.Context) {
+		p, ok := PrincipalOf(ctx)
+		if !ok {
+			ctx.RespString(http.StatusOK, "anonymous")
+			return
+		}
+		ctx.RespString(http.StatusOK, p.Scheme+":"+p.Subject)
+	}
+	server.Get("/api/user", handler)
+	server.Get("/api/login", handler)
+	server.Get("/api/health", handler)
+	server.Use(http.MethodGet, "/api/*", NewMiddlewareBuilder(basic, apiKey).
+		SkipRoutes("/api/login").
+		SkipFunc(func(ctx *web.Context) bool {
+			return ctx.Req.URL.Path == "/api/health"
+		}).Build())
+	server.Get("/optional", handler)
+	server.Use(http.MethodGet, "/optional", NewMiddlewareBuilder(basic).Optional().Build())
+	server.Get("/error", handler)
+	server.Use(http.MethodGet, "/error",
+		NewMiddlewareBuilder(errAuthenticator{}).LogFunc(func(err error) {}).Build())
+
+	testCases := []struct {
+		name      string
+		path      string
+		setReq    func(req *http.Request)
+		wantCode  int
+		wantBody  string
+		wantAuthn []string
+	}{
+		{
+			name:      "no credentials",
+			path:      "/api/user",
+			wantCode:  http.StatusUnauthorized,
+			wantBody:  "Unauthorized",
+			wantAuthn: []string{`Basic realm="admin", charset="UTF-8"`},
+		},
+		{
+			name: "basic",
+			path: "/api/user",
+			setReq: func(req *http.Request) {
+				req.SetBasicAuth("tom", "123456")
+			},
+			wantCode: http.StatusOK,
+			wantBody: "basic:tom",
+		},
+		{
+			name: "wrong password",
+			path: "/api/user",
+			setReq: func(req *http.Request) {
+				req.SetBasicAuth("tom", "654321")
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantBody:  "Unauthorized",
+			wantAuthn: []string{`Basic realm="admin", charset="UTF-8"`},
+		},
+		{
+			name: "unknown user",
+			path: "/api/user",
+			setReq: func(req *http.Request) {
+				req.SetBasicAuth("jerry", "123456")
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Unauthorized",
+		},
+		{
+			name: "api key",
+			path: "/api/user",
+			setReq: func(req *http.Request) {
+				req.Header.Set("X-API-Key", "key1")
+			},
+			wantCode: http.StatusOK,
+			wantBody: "apikey:service-a",
+		},
+		{
+			name:     "api key in query",
+			path:     "/api/user?api_key=key1",
+			wantCode: http.StatusOK,
+			wantBody: "apikey:service-a",
+		},
+		{
+			name: "wrong api key",
+			path: "/api/user",
+			setReq: func(req *http.Request) {
+				req.Header.Set("X-API-Key", "key2")
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Unauthorized",
+		},
+		{
+			name:     "skip route",
+			path:     "/api/login",
+			wantCode: http.StatusOK,
+			wantBody: "anonymous",
+		},
+		{
+			name:     "skip func",
+			path:     "/api/health",
+			wantCode: http.StatusOK,
+			wantBody: "anonymous",
+		},
+		{
+			name:     "optional",
+			path:     "/optional",
+			wantCode: http.StatusOK,
+			wantBody: "anonymous",
+		},
+		{
+			name: "optional but invalid",
+			path: "/optional",
+			setReq: func(req *http.Request) {
+				req.SetBasicAuth("tom", "654321")
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Unauthorized",
+		},
+		{
+			name:     "error",
+			path:     "/error",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Internal Server Error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.setReq != nil {
+				tc.setReq(req)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			if tc.wantAuthn != nil {
+				assert.Equal(t, tc.wantAuthn, recorder.Header().Values("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestNewMiddlewareBuilder(t *testing.T) {
+	assert.Panics(t, func() {
+		NewMiddlewareBuilder()
+	})
+}
+
+func TestRotatingKeys(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	keys := NewRotatingKeys(map[string]string{"old": "service-a"})
+	keys.now = func() time.Time { return now }
+
+	name, err := keys.Lookup(context.Background(), "old")
+	assert.NoError(t, err)
+	assert.Equal(t, "service-a", name)
+
+	keys.Rotate(map[string]string{"new": "service-a"}, time.Hour)
+	name, err = keys.Lookup(context.Background(), "new")
+	assert.NoError(t, err)
+	assert.Equal(t, "service-a", name)
+	// 旧的 key 在 grace 时间之内还能用
+	name, err = keys.Lookup(context.Background(), "old")
+	assert.NoError(t, err)
+	assert.Equal(t, "service-a", name)
+
+	now = now.Add(time.Hour)
+	_, err = keys.Lookup(context.Background(), "old")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	keys.Rotate(map[string]string{"newer": "service-a"}, time.Hour)
+	_, err = keys.Lookup(context.Background(), "old")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = keys.Lookup(context.Background(), "new")
+	assert.NoError(t, err)
+}
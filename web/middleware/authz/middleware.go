@@ -0,0 +1,117 @@
+package authz
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/middleware/auth"
+)
+
+// RolesFunc 补充用户的角色和权限, 例如 Basic 和 API key 认证的用户, 要从数据库里面查
+type RolesFunc func(ctx *web.Context, p *auth.Principal) (roles []string, permissions []string, err error)
+
+// MiddlewareBuilder 按照 ctx.MatchedRoute 和 HTTP 方法找到规则, 检查用户的角色和权限
+// 要放在 auth 中间件后面, 并且注册成路由级别的中间件, 全局中间件执行的时候还没有匹配路由
+type MiddlewareBuilder struct {
+	idx          index
+	defaultAllow bool
+	rolesFunc    RolesFunc
+	logFunc      func(err error)
+}
+
+func NewMiddlewareBuilder(p *Policy) *MiddlewareBuilder {
+	if err := p.Validate(); err != nil {
+		panic(fmt.Sprintf("web: %v", err))
+	}
+	return &MiddlewareBuilder{
+		idx:          newIndex(p),
+		defaultAllow: p.DefaultAllow,
+		logFunc: func(err error) {
+			fmt.Printf("authz: 获取角色出错 %v\n", err)
+		},
+	}
+}
+
+// RolesFunc 设置了之后, 用它返回的角色和权限, 不再用 Principal 上面的
+func (m *MiddlewareBuilder) RolesFunc(fn RolesFunc) *MiddlewareBuilder {
+	m.rolesFunc = fn
+	return m
+}
+
+func (m *MiddlewareBuilder) LogFunc(fn func(err error)) *MiddlewareBuilder {
+	m.logFunc = fn
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			rules := m.idx.rulesOf(ctx.MatchedRoute, ctx.Req.Method)
+			if len(rules) == 0 {
+				if m.defaultAllow {
+					next(ctx)
+					return
+				}
+				forbidden(ctx, "")
+				return
+			}
+
+			p, ok := auth.PrincipalOf(ctx)
+			if !ok {
+				ctx.RespStatusCode = http.StatusUnauthorized
+				ctx.RespData = []byte("Unauthorized")
+				return
+			}
+			roles, perms := p.Roles, p.Permissions
+			if m.rolesFunc != nil {
+				var err error
+				roles, perms, err = m.rolesFunc(ctx, p)
+				if err != nil {
+					m.logFunc(err)
+					ctx.RespStatusCode = http.StatusInternalServerError
+					ctx.RespData = []byte("Internal Server Error")
+					return
+				}
+			}
+
+			// 拒绝优先
+			allowed := false
+			for _, r := range rules {
+				if !r.matches(roles, perms) {
+					continue
+				}
+				if r.Effect == Deny {
+					forbidden(ctx, r.Reason)
+					return
+				}
+				allowed = true
+			}
+			if !allowed {
+				forbidden(ctx, "")
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+func (r *Rule) matches(roles, perms []string) bool {
+	if len(r.Roles) == 0 && len(r.Permissions) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(r.Roles, func(role string) bool {
+		return slices.Contains(roles, role)
+	}) || slices.ContainsFunc(r.Permissions, func(perm string) bool {
+		return slices.Contains(perms, perm)
+	})
+}
+
+func forbidden(ctx *web.Context, reason string) {
+	if reason == "" {
+		reason = "Forbidden"
+	}
+	ctx.RespStatusCode = http.StatusForbidden
+	ctx.RespData = []byte(reason)
+}
@@ -0,0 +1,229 @@
+package authz
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/middleware/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockAuth 从头部里面读用户和角色, 代替 auth 中间件
+func mockAuth(next web.HandleFunc) web.HandleFunc {
+	return func(ctx *web.Context) {
+		if sub := ctx.Req.Header.Get("X-User"); sub != "" {
+			auth.SetPrincipal(ctx, &auth.Principal{
+				Subject:     sub,
+				Roles:       strings.Fields(ctx.Req.Header.Get("X-Roles")),
+				Permissions: strings.Fields(ctx.Req.Header.Get("X-Perms")),
+			})
+		}
+		next(ctx)
+	}
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	policy := &Policy{
+		Rules: []Rule{
+			{Route: "/user/:id", Methods: []string{http.MethodGet}, Effect: Allow},
+			{Route: "/user/:id", Methods: []string{http.MethodPut}, Effect: Allow,
+				Roles: []string{"admin"}, Permissions: []string{"user:write"}},
+			{Route: "/user/:id", Effect: Deny, Roles: []string{"banned"}, Reason: "账号已被封禁"},
+			{Route: "/admin/*", Methods: []string{"*"}, Effect: Allow, Roles: []string{"admin"}},
+		},
+	}
+	mdl := NewMiddlewareBuilder(policy).Build()
+
+	server := web.NewHTTPServer()
+	handler := func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	}
+	server.Get("/user/:id", handler)
+	server.Put("/user/:id", handler)
+	server.Delete("/user/:id", handler)
+	server.Get("/admin/*", handler)
+	server.Get("/public", handler)
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		server.Use(method, "/user/:id", mockAuth, mdl)
+	}
+	server.Use(http.MethodGet, "/admin/*", mockAuth, mdl)
+	server.Use(http.MethodGet, "/public", mockAuth, mdl)
+
+	server.Get("/roles", handler)
+	server.Use(http.MethodGet, "/roles", mockAuth, NewMiddlewareBuilder(&Policy{
+		Rules: []Rule{{Route: "/roles", Effect: Allow, Roles: []string{"admin"}}},
+	}).RolesFunc(func(ctx *web.Context, p *auth.Principal) ([]string, []string, error) {
+		if p.Subject == "error" {
+			return nil, nil, errors.New("mock error")
+		}
+		// 比如说从数据库里面查
+		if p.Subject == "tom" {
+			return []string{"admin"}, nil, nil
+		}
+		return nil, nil, nil
+	}).LogFunc(func(err error) {}).Build())
+
+	server.Get("/default-allow", handler)
+	server.Use(http.MethodGet, "/default-allow", NewMiddlewareBuilder(&Policy{DefaultAllow: true}).Build())
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		user     string
+		roles    string
+		perms    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "not authenticated",
+			method:   http.MethodGet,
+			path:     "/user/1",
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Unauthorized",
+		},
+		{
+			name:     "any user",
+			method:   http.MethodGet,
+			path:     "/user/1",
+			user:     "tom",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "head uses get",
+			method:   http.MethodHead,
+			path:     "/user/1",
+			user:     "tom",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "missing role",
+			method:   http.MethodPut,
+			path:     "/user/1",
+			user:     "tom",
+			roles:    "user",
+			wantCode: http.StatusForbidden,
+			wantBody: "Forbidden",
+		},
+		{
+			name:     "role",
+			method:   http.MethodPut,
+			path:     "/user/1",
+			user:     "tom",
+			roles:    "user admin",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "permission",
+			method:   http.MethodPut,
+			path:     "/user/1",
+			user:     "tom",
+			perms:    "user:write",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "deny overrides",
+			method:   http.MethodPut,
+			path:     "/user/1",
+			user:     "tom",
+			roles:    "admin banned",
+			wantCode: http.StatusForbidden,
+			wantBody: "账号已被封禁",
+		},
+		{
+			name:     "deny all methods",
+			method:   http.MethodGet,
+			path:     "/user/1",
+			user:     "tom",
+			roles:    "banned",
+			wantCode: http.StatusForbidden,
+			wantBody: "账号已被封禁",
+		},
+		{
+			name:     "only deny rules",
+			method:   http.MethodDelete,
+			path:     "/user/1",
+			user:     "tom",
+			roles:    "admin",
+			wantCode: http.StatusForbidden,
+			wantBody: "Forbidden",
+		},
+		{
+			name:     "wildcard route",
+			method:   http.MethodGet,
+			path:     "/admin/a/b",
+			user:     "tom",
+			roles:    "admin",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "no rules",
+			method:   http.MethodGet,
+			path:     "/public",
+			user:     "tom",
+			roles:    "admin",
+			wantCode: http.StatusForbidden,
+			wantBody: "Forbidden",
+		},
+		{
+			name:     "roles func",
+			method:   http.MethodGet,
+			path:     "/roles",
+			user:     "tom",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "roles func ignores principal",
+			method:   http.MethodGet,
+			path:     "/roles",
+			user:     "jerry",
+			roles:    "admin",
+			wantCode: http.StatusForbidden,
+			wantBody: "Forbidden",
+		},
+		{
+			name:     "roles func error",
+			method:   http.MethodGet,
+			path:     "/roles",
+			user:     "error",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Internal Server Error",
+		},
+		{
+			name:     "default allow",
+			method:   http.MethodGet,
+			path:     "/default-allow",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("X-User", tc.user)
+			req.Header.Set("X-Roles", tc.roles)
+			req.Header.Set("X-Perms", tc.perms)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestNewMiddlewareBuilder(t *testing.T) {
+	assert.Panics(t, func() {
+		NewMiddlewareBuilder(&Policy{Rules: []Rule{{Route: "/user", Effect: "maybe"}}})
+	})
+}
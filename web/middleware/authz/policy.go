@@ -0,0 +1,115 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Rule 一条规则, 命中了路由和方法, 并且用户有其中一个角色或者权限, 就生效
+// Roles 和 Permissions 都为空的话, 对所有登录了的用户生效
+type Rule struct {
+	// Route 注册的路由, 也就是 ctx.MatchedRoute, 例如 /user/:id, /files/*
+	Route string `json:"route" yaml:"route"`
+	// Methods 为空或者有 * 的话是所有方法
+	Methods     []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Effect      Effect   `json:"effect" yaml:"effect"`
+	Roles       []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	// Reason 拒绝的时候返回给客户端的原因
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// Policy 拒绝优先: 只要有一条 deny 规则生效就拒绝, 否则要有一条 allow 规则生效才放过
+// 一条规则都没有配置的路由, 看 DefaultAllow
+type Policy struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+	// DefaultAllow 默认是拒绝, 漏配了路由也不会被越权访问
+	DefaultAllow bool `json:"default_allow,omitempty" yaml:"default_allow,omitempty"`
+}
+
+// Validate 检查规则有没有写错
+func (p *Policy) Validate() error {
+	for i, r := range p.Rules {
+		if r.Route == "" || r.Route[0] != '/' {
+			return fmt.Errorf("authz: 第 %d 条规则的路由不对 [%s]", i, r.Route)
+		}
+		if r.Effect != Allow && r.Effect != Deny {
+			return fmt.Errorf("authz: 第 %d 条规则的 effect 不对 [%s]", i, r.Effect)
+		}
+	}
+	return nil
+}
+
+// LoadPolicyFile 从 JSON 或者 YAML 文件加载, 按照扩展名判断格式
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		err = json.Unmarshal(data, &p)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &p)
+	default:
+		return nil, fmt.Errorf("authz: 不支持的文件格式 %s", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// index 按照路由和方法把规则分好, 这样每个请求只需要看自己的规则
+type index map[string]map[string][]*Rule
+
+func newIndex(p *Policy) index {
+	res := make(index, len(p.Rules))
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		methods, ok := res[r.Route]
+		if !ok {
+			methods = make(map[string][]*Rule, 4)
+			res[r.Route] = methods
+		}
+		if len(r.Methods) == 0 || slices.Contains(r.Methods, "*") {
+			methods["*"] = append(methods["*"], r)
+			continue
+		}
+		for _, m := range r.Methods {
+			methods[m] = append(methods[m], r)
+		}
+	}
+	return res
+}
+
+// rulesOf 路由和方法对应的规则
+// HEAD 没有配置的话用 GET 的, 和路由的行为保持一致
+func (idx index) rulesOf(route, method string) []*Rule {
+	methods, ok := idx[route]
+	if !ok {
+		return nil
+	}
+	rules, ok := methods[method]
+	if !ok && method == http.MethodHead {
+		rules = methods[http.MethodGet]
+	}
+	return append(slices.Clip(rules), methods["*"]...)
+}
@@ -0,0 +1,110 @@
+package authz
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPolicyFile(t *testing.T) {
+	want := &Policy{
+		Rules: []Rule{
+			{Route: "/user/:id", Methods: []string{"GET", "PUT"}, Effect: Allow, Roles: []string{"admin"}},
+			{Route: "/user/:id", Effect: Deny, Permissions: []string{"blocked"}, Reason: "账号已被封禁"},
+		},
+		DefaultAllow: true,
+	}
+
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+		want    *Policy
+		wantErr bool
+	}{
+		{
+			name: "json",
+			file: "policy.json",
+			content: `{"default_allow": true, "rules": [
+{"route": "/user/:id", "methods": ["GET", "PUT"], "effect": "allow", "roles": ["admin"]},
+{"route": "/user/:id", "effect": "deny", "permissions": ["blocked"], "reason": "账号已被封禁"}]}`,
+			want: want,
+		},
+		{
+			name: "yaml",
+			file: "policy.yaml",
+			content: `
+default_allow: true
+rules:
+  - route: /user/:id
+    methods: [GET, PUT]
+    effect: allow
+    roles: [admin]
+  - route: /user/:id
+    effect: deny
+    permissions: [blocked]
+    reason: 账号已被封禁
+`,
+			want: want,
+		},
+		{
+			name:    "invalid effect",
+			file:    "policy.yml",
+			content: "rules:\n  - route: /user\n    effect: maybe\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid route",
+			file:    "policy.json",
+			content: `{"rules": [{"route": "user", "effect": "allow"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			file:    "policy.json",
+			content: `{`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			file:    "policy.toml",
+			content: ``,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0600))
+			p, err := LoadPolicyFile(path)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, p)
+		})
+	}
+
+	_, err := LoadPolicyFile(filepath.Join(t.TempDir(), "none.json"))
+	assert.Error(t, err)
+}
+
+func TestIndex_rulesOf(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Route: "/user", Methods: []string{http.MethodGet}, Effect: Allow},
+		{Route: "/user", Methods: []string{http.MethodPost, http.MethodPut}, Effect: Allow},
+		{Route: "/user", Effect: Deny},
+	}}
+	idx := newIndex(p)
+	assert.Equal(t, []*Rule{&p.Rules[0], &p.Rules[2]}, idx.rulesOf("/user", http.MethodGet))
+	assert.Equal(t, []*Rule{&p.Rules[0], &p.Rules[2]}, idx.rulesOf("/user", http.MethodHead))
+	assert.Equal(t, []*Rule{&p.Rules[1], &p.Rules[2]}, idx.rulesOf("/user", http.MethodPut))
+	assert.Equal(t, []*Rule{&p.Rules[2]}, idx.rulesOf("/user", http.MethodDelete))
+	assert.Empty(t, idx.rulesOf("/order", http.MethodGet))
+}
@@ -0,0 +1,76 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// Encoder 一种压缩算法, 要支持 brotli 之类的算法, 实现这个接口就可以
+// 会被多个 goroutine 同时使用
+type Encoder interface {
+	// Encoding Accept-Encoding 和 Content-Encoding 里面的名字, 例如 gzip
+	Encoding() string
+	Encode(data []byte) ([]byte, error)
+}
+
+// writerEncoder 标准库里面的压缩算法都是 io.WriteCloser 加 Reset, 复用 writer 能省掉不少内存分配
+type writerEncoder struct {
+	encoding string
+	pool     sync.Pool
+}
+
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func (e *writerEncoder) Encoding() string {
+	return e.encoding
+}
+
+func (e *writerEncoder) Encode(data []byte) ([]byte, error) {
+	w := e.pool.Get().(resetWriter)
+	defer e.pool.Put(w)
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	w.Reset(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewGzipEncoder level 和 gzip 包里面的一样, 例如 gzip.DefaultCompression
+func NewGzipEncoder(level int) (Encoder, error) {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
+	}
+	return &writerEncoder{
+		encoding: "gzip",
+		pool: sync.Pool{New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, level)
+			return w
+		}},
+	}, nil
+}
+
+// NewDeflateEncoder HTTP 里面的 deflate 其实是 zlib 格式(RFC 1950), 不是裸的 deflate
+// level 和 zlib 包里面的一样, 例如 zlib.DefaultCompression
+func NewDeflateEncoder(level int) (Encoder, error) {
+	if _, err := zlib.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
+	}
+	return &writerEncoder{
+		encoding: "deflate",
+		pool: sync.Pool{New: func() any {
+			w, _ := zlib.NewWriterLevel(io.Discard, level)
+			return w
+		}},
+	}, nil
+}
@@ -0,0 +1,154 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Moty1999/web/web"
+)
+
+type MiddlewareBuilder struct {
+	// 按照服务端的偏好排序, 客户端的 q 值一样的时候用前面的
+	encoders []Encoder
+	// 响应体小于 minSize 不压缩, 压缩小数据不划算
+	minSize int
+	// 已经压缩过的类型, 再压缩没有意义, 按照前缀匹配, 例如 image/
+	skipTypes []string
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	gz, _ := NewGzipEncoder(gzip.DefaultCompression)
+	deflate, _ := NewDeflateEncoder(zlib.DefaultCompression)
+	return &MiddlewareBuilder{
+		encoders: []Encoder{gz, deflate},
+		minSize:  1024,
+		skipTypes: []string{
+			"image/", "video/", "audio/", "font/woff",
+			"application/zip", "application/gzip", "application/x-gzip",
+			"application/x-7z-compressed", "application/x-rar-compressed",
+			"application/octet-stream", "application/pdf", "application/wasm",
+		},
+	}
+}
+
+// Encoders 替换掉默认的 gzip 和 deflate
+func (m *MiddlewareBuilder) Encoders(encoders ...Encoder) *MiddlewareBuilder {
+	m.encoders = encoders
+	return m
+}
+
+// AddEncoder 加一种压缩算法, 优先级最高
+func (m *MiddlewareBuilder) AddEncoder(encoder Encoder) *MiddlewareBuilder {
+	m.encoders = append([]Encoder{encoder}, m.encoders...)
+	return m
+}
+
+func (m *MiddlewareBuilder) MinSize(size int) *MiddlewareBuilder {
+	m.minSize = size
+	return m
+}
+
+// SkipContentTypes 追加不需要压缩的类型, 按照前缀匹配
+func (m *MiddlewareBuilder) SkipContentTypes(types ...string) *MiddlewareBuilder {
+	m.skipTypes = append(m.skipTypes, types...)
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			next(ctx)
+			// 压缩的是 RespData, 流式输出的时候 RespData 是空的, 会被 minSize 拦下来
+			if len(ctx.RespData) < m.minSize || !compressibleStatus(ctx.RespStatusCode) {
+				return
+			}
+			header := ctx.Resp.Header()
+			if header.Get("Content-Encoding") != "" {
+				return
+			}
+			contentType := header.Get("Content-Type")
+			if contentType == "" {
+				// 压缩之后 net/http 就猜不出来了, 所以要在压缩之前猜
+				contentType = http.DetectContentType(ctx.RespData)
+				header.Set("Content-Type", contentType)
+			}
+			if m.skip(contentType) {
+				return
+			}
+
+			// 不管这一次有没有压缩, 缓存都要按照 Accept-Encoding 区分
+			web.AddVary(header, "Accept-Encoding")
+			encoder := m.negotiate(ctx.Req.Header.Get("Accept-Encoding"))
+			if encoder == nil {
+				return
+			}
+			data, err := encoder.Encode(ctx.RespData)
+			// 压缩失败或者压缩了反而更大, 就原样返回
+			if err != nil || len(data) >= len(ctx.RespData) {
+				return
+			}
+			header.Set("Content-Encoding", encoder.Encoding())
+			header.Del("Content-Length")
+			ctx.RespData = data
+		}
+	}
+}
+
+// compressibleStatus 没设置状态码的话就是 200
+func compressibleStatus(status int) bool {
+	return status == 0 || status >= http.StatusOK &&
+		status != http.StatusNoContent && status != http.StatusNotModified &&
+		status != http.StatusPartialContent
+}
+
+func (m MiddlewareBuilder) skip(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	// svg 是文本, 可以压缩
+	if mediaType == "image/svg+xml" {
+		return false
+	}
+	for _, typ := range m.skipTypes {
+		if strings.HasPrefix(mediaType, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate 按照 q 值选择, q 值一样的按照服务端的偏好
+// 没有可用的, 或者客户端不接受压缩的时候返回 nil
+func (m MiddlewareBuilder) negotiate(acceptEncoding string) Encoder {
+	if acceptEncoding == "" {
+		return nil
+	}
+	qs := make(map[string]float64, 4)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if key, val, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				q = f
+			}
+		}
+		qs[coding] = q
+	}
+
+	var res Encoder
+	best := 0.0
+	for _, encoder := range m.encoders {
+		q, ok := qs[encoder.Encoding()]
+		if !ok {
+			// * 匹配没有明确写出来的算法
+			q, ok = qs["*"]
+		}
+		if ok && q > best {
+			res, best = encoder, q
+		}
+	}
+	return res
+}
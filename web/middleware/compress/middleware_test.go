@@ -0,0 +1,212 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Moty1999/web/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reverseEncoder 测试自定义的压缩算法
+type reverseEncoder struct{}
+
+func (reverseEncoder) Encoding() string {
+	return "reverse"
+}
+
+func (reverseEncoder) Encode(data []byte) ([]byte, error) {
+	return []byte("short"), nil
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	body := "[" + strings.Repeat(`{"name":"Tom"},`, 200) + `{"name":"Tom"}]`
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.js"), []byte(strings.Repeat("console.log(1);", 200)), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logo.png"), []byte(strings.Repeat("p", 2048)), 0o644))
+	static, err := web.NewStaticResourceHandler(dir)
+	require.NoError(t, err)
+
+	server := web.NewHTTPServer(web.ServerWithMiddleware(NewMiddlewareBuilder().Build()))
+	server.Get("/json", func(ctx *web.Context) {
+		ctx.RespBytes(http.StatusOK, "application/json", []byte(body))
+	})
+	server.Get("/small", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "hello")
+	})
+	server.Get("/encoded", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("Content-Encoding", "br")
+		ctx.RespBytes(http.StatusOK, "text/plain", []byte(body))
+	})
+	server.Get("/static/*file", static.Handle)
+
+	custom := web.NewHTTPServer(web.ServerWithMiddleware(NewMiddlewareBuilder().AddEncoder(reverseEncoder{}).MinSize(10).Build()))
+	custom.Get("/json", func(ctx *web.Context) {
+		ctx.RespBytes(http.StatusOK, "application/json", []byte(body))
+	})
+
+	// 全局和路由上都注册了
+	twice := web.NewHTTPServer(web.ServerWithMiddleware(NewMiddlewareBuilder().Build()))
+	twice.Get("/json", func(ctx *web.Context) {
+		ctx.RespBytes(http.StatusOK, "application/json", []byte(body))
+	})
+	twice.Use(http.MethodGet, "/json", NewMiddlewareBuilder().Build())
+
+	testCases := []struct {
+		name           string
+		server         *web.HTTPServer
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		wantVary       string
+		wantBody       string
+	}{
+		{
+			name:           "gzip",
+			path:           "/json",
+			acceptEncoding: "gzip, deflate, br",
+			wantEncoding:   "gzip",
+			wantVary:       "Accept-Encoding",
+			wantBody:       body,
+		},
+		{
+			name:           "q value",
+			path:           "/json",
+			acceptEncoding: "gzip;q=0.5, deflate",
+			wantEncoding:   "deflate",
+			wantVary:       "Accept-Encoding",
+			wantBody:       body,
+		},
+		{
+			name:           "wildcard",
+			path:           "/json",
+			acceptEncoding: "gzip;q=0, *",
+			wantEncoding:   "deflate",
+			wantVary:       "Accept-Encoding",
+			wantBody:       body,
+		},
+		{
+			name:     "not accept",
+			path:     "/json",
+			wantVary: "Accept-Encoding",
+			wantBody: body,
+		},
+		{
+			name:           "identity only",
+			path:           "/json",
+			acceptEncoding: "identity",
+			wantVary:       "Accept-Encoding",
+			wantBody:       body,
+		},
+		{
+			name:           "too small",
+			path:           "/small",
+			acceptEncoding: "gzip",
+			wantBody:       "hello",
+		},
+		{
+			name:           "already encoded",
+			path:           "/encoded",
+			acceptEncoding: "gzip",
+			wantEncoding:   "br",
+			wantBody:       body,
+		},
+		{
+			name:           "static text",
+			path:           "/static/app.js",
+			acceptEncoding: "gzip",
+			wantEncoding:   "gzip",
+			wantVary:       "Accept-Encoding",
+			wantBody:       strings.Repeat("console.log(1);", 200),
+		},
+		{
+			name:           "static image",
+			path:           "/static/logo.png",
+			acceptEncoding: "gzip",
+			wantBody:       strings.Repeat("p", 2048),
+		},
+		{
+			name:           "custom encoder",
+			server:         custom,
+			path:           "/json",
+			acceptEncoding: "gzip, reverse",
+			wantEncoding:   "reverse",
+			wantVary:       "Accept-Encoding",
+			wantBody:       "short",
+		},
+		{
+			// 两个都没有压缩, 都要加 Vary
+			name:     "registered twice",
+			server:   twice,
+			path:     "/json",
+			wantVary: "Accept-Encoding",
+			wantBody: body,
+		},
+		{
+			name:           "registered twice gzip",
+			server:         twice,
+			path:           "/json",
+			acceptEncoding: "gzip",
+			wantEncoding:   "gzip",
+			wantVary:       "Accept-Encoding",
+			wantBody:       body,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.server
+			if s == nil {
+				s = server
+			}
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			header := recorder.Header()
+			assert.Equal(t, tc.wantEncoding, header.Get("Content-Encoding"))
+			assert.Equal(t, tc.wantVary, strings.Join(header.Values("Vary"), ", "))
+			if tc.wantEncoding != "" && tc.wantEncoding != "br" {
+				assert.Empty(t, header.Get("Content-Length"))
+			}
+			assert.Equal(t, tc.wantBody, decode(t, tc.wantEncoding, recorder.Body.Bytes()))
+		})
+	}
+}
+
+func TestNewGzipEncoder_InvalidLevel(t *testing.T) {
+	_, err := NewGzipEncoder(100)
+	assert.Error(t, err)
+	_, err = NewDeflateEncoder(100)
+	assert.Error(t, err)
+}
+
+func decode(t *testing.T, encoding string, data []byte) string {
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return string(data)
+	}
+	require.NoError(t, err)
+	res, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(res)
+}
@@ -0,0 +1,193 @@
+package cors
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Moty1999/web/web"
+)
+
+// MiddlewareBuilder 处理跨域请求
+// 可以注册成全局中间件, 也可以注册在分组或者路由上
+// 自动应答的 OPTIONS 只会经过注册在 OPTIONS 上的中间件, 所以注册在分组或者路由上的时候
+// 还要单独注册到 OPTIONS 上, 例如 server.Use(http.MethodOptions, "/api/*", cors), 由它应答预检请求
+// 要放在鉴权之类的中间件前面, 因为浏览器的预检请求不会带上凭证
+type MiddlewareBuilder struct {
+	// 精确匹配, 或者 *, 或者 https://*.example.com 这种只有一个通配符的
+	allowOrigins       []string
+	allowOriginRegexps []*regexp.Regexp
+	allowOriginFunc    func(origin string) bool
+
+	allowMethods []string
+	// 为空的时候, 预检请求要什么头部就允许什么头部
+	allowHeaders     []string
+	exposeHeaders    []string
+	allowCredentials bool
+	// 浏览器缓存预检结果的时间, 0 代表不设置
+	maxAge time.Duration
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		allowMethods: []string{
+			http.MethodGet, http.MethodHead, http.MethodPost,
+			http.MethodPut, http.MethodPatch, http.MethodDelete,
+		},
+	}
+}
+
+// AllowOrigins 允许的来源, 例如 https://example.com, https://*.example.com 或者 *
+func (m *MiddlewareBuilder) AllowOrigins(origins ...string) *MiddlewareBuilder {
+	m.allowOrigins = append(m.allowOrigins, origins...)
+	return m
+}
+
+// AllowOriginRegexps 用正则表达式匹配来源, 表达式不合法会 panic
+// 和正则路由一样, 要匹配整个来源, 不然 https://.*\.example\.com 也会匹配上 https://x.example.com.attacker.com
+func (m *MiddlewareBuilder) AllowOriginRegexps(exprs ...string) *MiddlewareBuilder {
+	for _, expr := range exprs {
+		m.allowOriginRegexps = append(m.allowOriginRegexps, regexp.MustCompile("^(?:"+expr+")$"))
+	}
+	return m
+}
+
+// AllowOriginFunc 自定义的来源检查, 例如从数据库里面读租户的域名
+func (m *MiddlewareBuilder) AllowOriginFunc(fn func(origin string) bool) *MiddlewareBuilder {
+	m.allowOriginFunc = fn
+	return m
+}
+
+// AllowMethods 替换掉默认的方法
+func (m *MiddlewareBuilder) AllowMethods(methods ...string) *MiddlewareBuilder {
+	m.allowMethods = methods
+	return m
+}
+
+func (m *MiddlewareBuilder) AllowHeaders(headers ...string) *MiddlewareBuilder {
+	m.allowHeaders = append(m.allowHeaders, headers...)
+	return m
+}
+
+// ExposeHeaders 前端 JS 可以读到的响应头
+func (m *MiddlewareBuilder) ExposeHeaders(headers ...string) *MiddlewareBuilder {
+	m.exposeHeaders = append(m.exposeHeaders, headers...)
+	return m
+}
+
+// AllowCredentials 允许带上 cookie
+// 这个时候 Access-Control-Allow-Origin 不能是 *, 会换成请求的 Origin
+func (m *MiddlewareBuilder) AllowCredentials(allow bool) *MiddlewareBuilder {
+	m.allowCredentials = allow
+	return m
+}
+
+func (m *MiddlewareBuilder) MaxAge(maxAge time.Duration) *MiddlewareBuilder {
+	m.maxAge = maxAge
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	allowMethods := strings.Join(m.allowMethods, ", ")
+	allowHeaders := strings.Join(m.allowHeaders, ", ")
+	exposeHeaders := strings.Join(m.exposeHeaders, ", ")
+	var maxAge string
+	if m.maxAge > 0 {
+		maxAge = strconv.Itoa(int(m.maxAge.Seconds()))
+	}
+	allowAll := slices.Contains(m.allowOrigins, "*")
+
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			origin := ctx.Req.Header.Get("Origin")
+			// 不是跨域请求
+			if origin == "" {
+				next(ctx)
+				return
+			}
+
+			header := ctx.Resp.Header()
+			// 响应和 Origin 有关, 缓存要按照 Origin 区分
+			if !allowAll || m.allowCredentials {
+				web.AddVary(header, "Origin")
+			}
+			preflight := ctx.Req.Method == http.MethodOptions &&
+				ctx.Req.Header.Get("Access-Control-Request-Method") != ""
+
+			if !m.allowOrigin(origin) {
+				if preflight {
+					ctx.RespStatusCode = http.StatusForbidden
+					ctx.RespData = []byte("Forbidden")
+					return
+				}
+				// 不带 CORS 头部, 浏览器自己会拦下来
+				next(ctx)
+				return
+			}
+
+			if allowAll && !m.allowCredentials {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if m.allowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposeHeaders != "" {
+					header.Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+				next(ctx)
+				return
+			}
+
+			// 预检请求直接应答, 不需要注册 OPTIONS 路由
+			web.AddVary(header, "Access-Control-Request-Method")
+			web.AddVary(header, "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", allowHeaders)
+			} else if reqHeaders := ctx.Req.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+			if maxAge != "" {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+			ctx.RespStatusCode = http.StatusNoContent
+			ctx.RespData = nil
+		}
+	}
+}
+
+func (m MiddlewareBuilder) allowOrigin(origin string) bool {
+	for _, allow := range m.allowOrigins {
+		if matchOrigin(allow, origin) {
+			return true
+		}
+	}
+	for _, reg := range m.allowOriginRegexps {
+		if reg.MatchString(origin) {
+			return true
+		}
+	}
+	return m.allowOriginFunc != nil && m.allowOriginFunc(origin)
+}
+
+// matchOrigin 来源不区分大小写, * 只能匹配一段以上的字符
+func matchOrigin(pattern string, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return strings.EqualFold(pattern, origin)
+	}
+	origin = strings.ToLower(origin)
+	prefix, suffix = strings.ToLower(prefix), strings.ToLower(suffix)
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
@@ -0,0 +1,329 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	builder := NewMiddlewareBuilder().
+		AllowOrigins("https://app.example.com", "https://*.example.org").
+		AllowOriginRegexps(`^http://localhost:\d+$`, `https://.*\.example\.net`).
+		ExposeHeaders("X-Request-ID").
+		AllowCredentials(true).
+		MaxAge(10 * time.Minute)
+
+	// 注册在分组上, 分组里面还有鉴权
+	server := web.NewHTTPServer()
+	auth := func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			if ctx.Req.Header.Get("Authorization") == "" {
+				ctx.RespStatusCode = http.StatusUnauthorized
+				return
+			}
+			next(ctx)
+		}
+	}
+	cors := builder.Build()
+	api := server.Group("/api", cors, auth)
+	// 预检请求不会经过分组上的鉴权, 要单独注册到 OPTIONS 上
+	server.Use(http.MethodOptions, "/api/*", cors)
+	api.Get("/user/:id", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "user")
+	})
+	api.Post("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusCreated, "created")
+	})
+	server.Get("/public", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "public")
+	})
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		header     map[string]string
+		wantCode   int
+		wantHeader map[string]string
+	}{
+		{
+			name:   "preflight",
+			method: http.MethodOptions,
+			path:   "/api/user/123",
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodGet,
+				"Access-Control-Request-Headers": "Authorization, Content-Type",
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+				"Access-Control-Max-Age":           "600",
+				"Allow":                            "GET, HEAD, OPTIONS",
+			},
+		},
+		{
+			name:   "preflight wildcard origin",
+			method: http.MethodOptions,
+			path:   "/api/user",
+			header: map[string]string{
+				"Origin":                        "https://admin.example.org",
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "https://admin.example.org",
+			},
+		},
+		{
+			name:   "preflight regexp origin",
+			method: http.MethodOptions,
+			path:   "/api/user",
+			header: map[string]string{
+				"Origin":                        "http://localhost:5173",
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "http://localhost:5173",
+			},
+		},
+		{
+			name:   "preflight unanchored regexp origin",
+			method: http.MethodOptions,
+			path:   "/api/user",
+			header: map[string]string{
+				"Origin":                        "https://x.example.net",
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "https://x.example.net",
+			},
+		},
+		{
+			// 正则要匹配整个来源, 后面接上攻击者的域名不行
+			name:   "preflight regexp origin suffix",
+			method: http.MethodOptions,
+			path:   "/api/user",
+			header: map[string]string{
+				"Origin":                        "https://x.example.net.attacker.com",
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			wantCode: http.StatusForbidden,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "actual request regexp origin suffix",
+			method: http.MethodGet,
+			path:   "/api/user/123",
+			header: map[string]string{
+				"Origin":        "https://x.example.net.attacker.com",
+				"Authorization": "token",
+			},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:   "preflight forbidden origin",
+			method: http.MethodOptions,
+			path:   "/api/user",
+			header: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			wantCode: http.StatusForbidden,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "actual request",
+			method: http.MethodGet,
+			path:   "/api/user/123",
+			header: map[string]string{
+				"Origin":        "https://app.example.com",
+				"Authorization": "token",
+			},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": "X-Request-ID",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:   "actual request forbidden origin",
+			method: http.MethodGet,
+			path:   "/api/user/123",
+			header: map[string]string{
+				"Origin":        "https://example.org",
+				"Authorization": "token",
+			},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			// 不是预检请求, 还是交给后面, 自动应答不会经过分组上的鉴权
+			name:     "plain options",
+			method:   http.MethodOptions,
+			path:     "/api/user",
+			header:   map[string]string{"Origin": "https://app.example.com"},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Allow": "OPTIONS, POST",
+			},
+		},
+		{
+			name:   "outside group",
+			method: http.MethodOptions,
+			path:   "/public",
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": http.MethodGet,
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Allow":                       "GET, HEAD, OPTIONS",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for key, val := range tc.header {
+				req.Header.Set(key, val)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			for key, val := range tc.wantHeader {
+				assert.Equal(t, val, recorder.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Global(t *testing.T) {
+	server := web.NewHTTPServer(web.ServerWithMiddleware(
+		NewMiddlewareBuilder().AllowOrigins("*").AllowHeaders("Content-Type").Build()))
+	server.Get("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "user")
+	})
+
+	// 全局的 CORS 在路由之前就应答了预检请求, 没有注册的路径也一样
+	for _, path := range []string{"/user", "/none"} {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", "https://any.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+		req.Header.Set("Access-Control-Request-Headers", "X-Token")
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+		assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Content-Type", recorder.Header().Get("Access-Control-Allow-Headers"))
+		assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Empty(t, recorder.Header().Get("Access-Control-Max-Age"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+// 注册在分组上的 CORS 要单独注册到 OPTIONS 上才会应答预检请求
+func TestMiddlewareBuilder_GroupPreflight(t *testing.T) {
+	newServer := func(options bool) *web.HTTPServer {
+		cors := NewMiddlewareBuilder().AllowOrigins("https://app.example.com").Build()
+		// 全局的和分组上的一起用, Vary 也只有一个
+		server := web.NewHTTPServer(web.ServerWithMiddleware(cors))
+		server.Group("/api", cors).Get("/user", func(ctx *web.Context) {
+			ctx.RespString(http.StatusOK, "user")
+		})
+		if options {
+			server.Use(http.MethodOptions, "/api/*", cors)
+		}
+		return server
+	}
+	do := func(server *web.HTTPServer, method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/user", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	for _, options := range []bool{false, true} {
+		server := newServer(options)
+		recorder := do(server, http.MethodGet)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "https://app.example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, []string{"Origin"}, recorder.Header().Values("Vary"))
+
+		recorder = do(server, http.MethodOptions)
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+		assert.Equal(t, "https://app.example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			recorder.Header().Values("Vary"))
+	}
+
+	// 只有分组上的, 没有注册到 OPTIONS 上, 预检请求由框架自动应答, 没有 CORS 的头部
+	cors := NewMiddlewareBuilder().AllowOrigins("https://app.example.com").Build()
+	server := web.NewHTTPServer()
+	server.Group("/api", cors).Get("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "user")
+	})
+	recorder := do(server, http.MethodOptions)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD, OPTIONS", recorder.Header().Get("Allow"))
+
+	// 注册到 OPTIONS 上之后, 由 CORS 应答
+	server.Use(http.MethodOptions, "/api/*", cors)
+	recorder = do(server, http.MethodOptions)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "https://app.example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE", recorder.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func TestMatchOrigin(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://a.com", true},
+		{"https://a.com", "https://A.com", true},
+		{"https://a.com", "https://a.com.evil.com", false},
+		{"https://*.a.com", "https://x.a.com", true},
+		{"https://*.a.com", "https://x.y.a.com", true},
+		{"https://*.a.com", "https://.a.com", false},
+		{"https://*.a.com", "https://a.com", false},
+		{"https://*.a.com", "http://x.a.com", false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, matchOrigin(tc.pattern, tc.origin), tc.pattern+" "+tc.origin)
+	}
+}
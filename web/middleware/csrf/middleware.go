@@ -0,0 +1,294 @@
+package csrf
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/session"
+)
+
+// token 在 session 和 ctx.UserValues 里面的 key
+const tokenKey = "csrf_token"
+
+// 放到 ctx.Req.Context() 里面用的 key, 模板函数只能拿到这个
+type ctxKey struct{}
+
+// MiddlewareBuilder 对不安全的方法(POST, PUT, DELETE 之类)检查 CSRF token
+// token 从头部或者表单字段里面读, 页面上用 FuncMap 里面的模板函数嵌进去, 前端 JS 用 Token 拿到之后放到头部里面
+// 用 ExemptRoutes 排除的话, 要注册成路由级别的中间件, 全局中间件执行的时候还没有匹配路由, 只能按照路径比较
+type MiddlewareBuilder struct {
+	// session 模式, token 存在 session 里面
+	manager *session.Manager
+	// double submit 模式, token 放在 cookie 里面, 用 secret 签名
+	secret []byte
+	// 签名的时候带上的客户端标识, 例如 session ID, 为 nil 或者返回空字符串的话 token 不绑定任何东西
+	bindFunc func(ctx *web.Context) string
+
+	header     string
+	field      string
+	cookieName string
+	secure     bool
+
+	exemptRoutes map[string]struct{}
+	exemptFunc   func(ctx *web.Context) bool
+	logFunc      func(err error)
+}
+
+// NewMiddlewareBuilder session 模式, 每个 session 一个 token, 通过 session.Session.Set 存起来
+// 没有 session 的请求不会有 token, 不安全的方法会被拒绝, 所以登录接口要么排除掉, 要么用 double submit 模式
+// 只有 errors.Is(err, session.ErrSessionNotFound) 的才当成没有 session, 其它读 session 的错误返回 500
+func NewMiddlewareBuilder(m *session.Manager) *MiddlewareBuilder {
+	res := newMiddlewareBuilder()
+	res.manager = m
+	return res
+}
+
+// NewDoubleSubmitMiddlewareBuilder double submit cookie 模式, 适合没有 session 的场景
+// token 放在 cookie 里面, 请求的时候头部或者表单里面的要和 cookie 里面的一样
+// 签名只能防止伪造 token, 子域名(或者中间人)可以把自己拿到的合法 token 写到受害者的 cookie 里面
+// 要防这种情况, 用 BindTo 把 token 和客户端绑定起来
+func NewDoubleSubmitMiddlewareBuilder(secret []byte) *MiddlewareBuilder {
+	if len(secret) == 0 {
+		panic("web: csrf 的 secret 不能为空")
+	}
+	res := newMiddlewareBuilder()
+	res.secret = secret
+	return res
+}
+
+func newMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		header:       "X-CSRF-Token",
+		field:        "csrf_token",
+		cookieName:   "csrf_token",
+		exemptRoutes: make(map[string]struct{}, 4),
+		logFunc: func(err error) {
+			fmt.Printf("csrf: 读写 session 出错 %v\n", err)
+		},
+	}
+}
+
+// Header 从哪个头部读 token, 默认是 X-CSRF-Token
+func (m *MiddlewareBuilder) Header(name string) *MiddlewareBuilder {
+	m.header = name
+	return m
+}
+
+// Field 从哪个表单字段读 token, 默认是 csrf_token
+func (m *MiddlewareBuilder) Field(name string) *MiddlewareBuilder {
+	m.field = name
+	return m
+}
+
+// Cookie double submit 模式下的 cookie, 默认是 csrf_token
+// cookie 不能是 HttpOnly, 不然前端的 JS 读不到
+func (m *MiddlewareBuilder) Cookie(name string, secure bool) *MiddlewareBuilder {
+	m.cookieName = name
+	m.secure = secure
+	return m
+}
+
+// BindTo double submit 模式下, 把 token 和 fn 返回的客户端标识绑定起来, 例如 session ID 或者登录的用户 ID
+// 别人的 token 在这个客户端上验证不通过, 标识变了(例如登录之后)旧的 token 也会失效, 会重新生成
+// fn 返回空字符串的时候 token 不绑定任何东西
+func (m *MiddlewareBuilder) BindTo(fn func(ctx *web.Context) string) *MiddlewareBuilder {
+	m.bindFunc = fn
+	return m
+}
+
+// ExemptRoutes 不检查这些路由, 用的是注册的路由, 例如 /webhook/:name
+func (m *MiddlewareBuilder) ExemptRoutes(routes ...string) *MiddlewareBuilder {
+	for _, route := range routes {
+		m.exemptRoutes[route] = struct{}{}
+	}
+	return m
+}
+
+// ExemptFunc 返回 true 的请求不检查, 例如带了 API key 的请求
+func (m *MiddlewareBuilder) ExemptFunc(fn func(ctx *web.Context) bool) *MiddlewareBuilder {
+	m.exemptFunc = fn
+	return m
+}
+
+func (m *MiddlewareBuilder) LogFunc(fn func(err error)) *MiddlewareBuilder {
+	m.logFunc = fn
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			var (
+				token string
+				err   error
+			)
+			if m.manager != nil {
+				token, err = m.sessionToken(ctx)
+			} else {
+				token, err = m.cookieToken(ctx)
+			}
+			if err != nil {
+				m.logFunc(err)
+				ctx.RespStatusCode = http.StatusInternalServerError
+				ctx.RespData = []byte("Internal Server Error")
+				return
+			}
+			if token != "" {
+				setToken(ctx, token)
+			}
+
+			if safeMethod(ctx.Req.Method) || m.exempt(ctx) {
+				next(ctx)
+				return
+			}
+			if token == "" || !equal(token, m.submitted(ctx)) {
+				ctx.RespStatusCode = http.StatusForbidden
+				ctx.RespData = []byte("CSRF token 不对")
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// sessionToken 没有 session 的话返回空字符串, 读 session 出错的话返回 error
+func (m MiddlewareBuilder) sessionToken(ctx *web.Context) (string, error) {
+	sess, err := m.manager.GetSession(ctx)
+	if errors.Is(err, session.ErrSessionNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	val, err := sess.Get(ctx.Req.Context(), tokenKey)
+	// 只有 session 里面还没有 token 才生成, 读出错了(例如 redis 挂了)就覆盖掉的话, 已经打开的表单都会失效
+	if err != nil && !errors.Is(err, session.ErrKeyNotFound) {
+		return "", err
+	}
+	if token, ok := val.(string); err == nil && ok && token != "" {
+		return token, nil
+	}
+	token := newToken()
+	if err = sess.Set(ctx.Req.Context(), tokenKey, token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// cookieToken cookie 里面没有, 或者签名不对的话, 生成一个新的
+// 新的 token 和请求里面提交的肯定对不上, 所以不安全的方法会被拒绝
+func (m MiddlewareBuilder) cookieToken(ctx *web.Context) (string, error) {
+	var client string
+	if m.bindFunc != nil {
+		client = m.bindFunc(ctx)
+	}
+	if c, err := ctx.Req.Cookie(m.cookieName); err == nil && m.verify(c.Value, client) {
+		return c.Value, nil
+	}
+	token := m.sign(newToken(), client)
+	http.SetCookie(ctx.Resp, &http.Cookie{
+		Name:     m.cookieName,
+		Value:    token,
+		Path:     "/",
+		Secure:   m.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+// sign 客户端标识也参与签名, 但是不放到 token 里面
+func (m MiddlewareBuilder) sign(val string, client string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(client))
+	// 分隔开, 不然 client 和 val 拼起来一样就会有一样的签名
+	mac.Write([]byte{0})
+	mac.Write([]byte(val))
+	return val + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (m MiddlewareBuilder) verify(token string, client string) bool {
+	val, _, ok := strings.Cut(token, ".")
+	return ok && equal(m.sign(val, client), token)
+}
+
+// submitted 先看头部, 再看表单
+func (m MiddlewareBuilder) submitted(ctx *web.Context) string {
+	if token := ctx.Req.Header.Get(m.header); token != "" {
+		return token
+	}
+	return ctx.Req.PostFormValue(m.field)
+}
+
+func (m MiddlewareBuilder) exempt(ctx *web.Context) bool {
+	route := ctx.MatchedRoute
+	if route == "" {
+		route = ctx.Req.URL.Path
+	}
+	if _, ok := m.exemptRoutes[route]; ok {
+		return true
+	}
+	return m.exemptFunc != nil && m.exemptFunc(ctx)
+}
+
+// FuncMap 模板函数, 参数是请求的 context, web.GoTemplateEngine 会把它放到 .Ctx 里面
+// csrfToken 返回 token, csrfField 返回一个隐藏的表单字段, 例如 <form>{{ csrfField .Ctx }}</form>
+// 和别的中间件一起用参考 web.GoTemplateEngine
+func (m *MiddlewareBuilder) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": TokenFromContext,
+		"csrfField": func(ctx context.Context) template.HTML {
+			return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+				template.HTMLEscapeString(m.field), template.HTMLEscapeString(TokenFromContext(ctx))))
+		},
+	}
+}
+
+// Token 拿到当前请求的 token, 例如放到 JSON 响应里面给前端用
+func Token(ctx *web.Context) string {
+	token, _ := ctx.UserValues[tokenKey].(string)
+	return token
+}
+
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(ctxKey{}).(string)
+	return token
+}
+
+func setToken(ctx *web.Context, token string) {
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 4)
+	}
+	ctx.UserValues[tokenKey] = token
+	ctx.Req = ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), ctxKey{}, token))
+}
+
+func newToken() string {
+	data := make([]byte, 32)
+	// crypto/rand 出错基本上意味着系统有问题了
+	if _, err := rand.Read(data); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
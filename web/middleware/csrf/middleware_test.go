@@ -0,0 +1,308 @@
+package csrf
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/session"
+	"github.com/Moty1999/web/web/session/cookie"
+	"github.com/Moty1999/web/web/session/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Session(t *testing.T) {
+	m := &session.Manager{
+		Propagator: cookie.NewPropagator(),
+		Store:      memory.NewStore(time.Minute),
+		CtxSessKey: "sess",
+	}
+	// 全局中间件还没有匹配路由, 按照路径排除
+	builder := NewMiddlewareBuilder(m).ExemptRoutes("/login")
+	tpl, err := template.New("form").Funcs(builder.FuncMap()).Parse(`<form>{{ csrfField .Ctx }}</form>`)
+	require.NoError(t, err)
+
+	server := web.NewHTTPServer(
+		web.ServerWithMiddleware(builder.Build()),
+		web.ServerWithTemplateEngine(&web.GoTemplateEngine{T: tpl}))
+	server.Post("/login", func(ctx *web.Context) {
+		_, err := m.InitSession(ctx)
+		require.NoError(t, err)
+	})
+	server.Get("/form", func(ctx *web.Context) {
+		_ = ctx.Render("form", nil)
+	})
+	server.Get("/token", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, Token(ctx))
+	})
+	server.Post("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	})
+
+	do := func(req *http.Request, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// 没有 session 就没有 token, 不安全的方法会被拒绝
+	resp := do(httptest.NewRequest(http.MethodPost, "/user", nil))
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	resp = do(httptest.NewRequest(http.MethodGet, "/token", nil))
+	assert.Equal(t, "", resp.Body.String())
+
+	// 登录接口本身不检查
+	resp = do(httptest.NewRequest(http.MethodPost, "/login", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	sessCookie := resp.Result().Cookies()[0]
+
+	resp = do(httptest.NewRequest(http.MethodGet, "/token", nil), sessCookie)
+	token := resp.Body.String()
+	assert.NotEmpty(t, token)
+	// 同一个 session 的 token 不变
+	resp = do(httptest.NewRequest(http.MethodGet, "/token", nil), sessCookie)
+	assert.Equal(t, token, resp.Body.String())
+
+	// 模板里面嵌进去的
+	resp = do(httptest.NewRequest(http.MethodGet, "/form", nil), sessCookie)
+	assert.Equal(t, `<form><input type="hidden" name="csrf_token" value="`+token+`"></form>`, resp.Body.String())
+
+	testCases := []struct {
+		name     string
+		header   string
+		form     string
+		wantCode int
+	}{
+		{name: "no token", wantCode: http.StatusForbidden},
+		{name: "wrong token", header: "abc", wantCode: http.StatusForbidden},
+		{name: "header", header: token, wantCode: http.StatusOK},
+		{name: "form", form: token, wantCode: http.StatusOK},
+		{name: "wrong form", form: token + "a", wantCode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req *http.Request
+			if tc.form != "" {
+				req = httptest.NewRequest(http.MethodPost, "/user",
+					strings.NewReader(url.Values{"csrf_token": {tc.form}}.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(http.MethodPost, "/user", nil)
+			}
+			if tc.header != "" {
+				req.Header.Set("X-CSRF-Token", tc.header)
+			}
+			resp := do(req, sessCookie)
+			assert.Equal(t, tc.wantCode, resp.Code)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_DoubleSubmit(t *testing.T) {
+	builder := NewDoubleSubmitMiddlewareBuilder([]byte("secret")).
+		Header("X-XSRF-Token").Cookie("xsrf", true)
+	server := web.NewHTTPServer()
+	server.Get("/token", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, Token(ctx))
+	})
+	server.Post("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	})
+	server.Post("/webhook", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "webhook")
+	})
+	mdl := builder.ExemptFunc(func(ctx *web.Context) bool {
+		return ctx.Req.Header.Get("X-API-Key") != ""
+	}).Build()
+	server.Use(http.MethodGet, "/token", mdl)
+	server.Use(http.MethodPost, "/user", mdl)
+	server.Use(http.MethodPost, "/webhook", builder.ExemptRoutes("/webhook").Build())
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/token", nil))
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	c := cookies[0]
+	assert.Equal(t, "xsrf", c.Name)
+	assert.True(t, c.Secure)
+	assert.False(t, c.HttpOnly)
+	assert.Equal(t, c.Value, recorder.Body.String())
+	assert.Regexp(t, regexp.MustCompile(`^[\w-]{43}\.[\w-]{43}$`), c.Value)
+
+	// 带着合法的 cookie 就不会再生成新的
+	req := httptest.NewRequest(http.MethodGet, "/token", nil)
+	req.AddCookie(c)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Empty(t, recorder.Result().Cookies())
+	assert.Equal(t, c.Value, recorder.Body.String())
+
+	// 签名不对, 比如说子域名写进来的 cookie
+	forged := &http.Cookie{Name: "xsrf", Value: "abc.def"}
+
+	testCases := []struct {
+		name     string
+		path     string
+		cookie   *http.Cookie
+		header   map[string]string
+		wantCode int
+	}{
+		{name: "ok", path: "/user", cookie: c, header: map[string]string{"X-XSRF-Token": c.Value}, wantCode: http.StatusOK},
+		{name: "no cookie", path: "/user", header: map[string]string{"X-XSRF-Token": c.Value}, wantCode: http.StatusForbidden},
+		{name: "no header", path: "/user", cookie: c, wantCode: http.StatusForbidden},
+		{name: "forged", path: "/user", cookie: forged, header: map[string]string{"X-XSRF-Token": forged.Value}, wantCode: http.StatusForbidden},
+		{name: "exempt func", path: "/user", header: map[string]string{"X-API-Key": "key"}, wantCode: http.StatusOK},
+		{name: "exempt route", path: "/webhook", wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			if tc.cookie != nil {
+				req.AddCookie(tc.cookie)
+			}
+			for key, val := range tc.header {
+				req.Header.Set(key, val)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_SessionError(t *testing.T) {
+	var logged error
+	m := &session.Manager{
+		Propagator: cookie.NewPropagator(),
+		Store:      errStore{Store: memory.NewStore(time.Minute)},
+		CtxSessKey: "sess",
+	}
+	server := web.NewHTTPServer(web.ServerWithMiddleware(
+		NewMiddlewareBuilder(m).LogFunc(func(err error) {
+			logged = err
+		}).Build()))
+	server.Get("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	})
+
+	// 没有 session 不算错误
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, logged)
+
+	// session 已经不存在了, 也不算错误
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(&http.Cookie{Name: "sessid", Value: "expired"})
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, logged)
+
+	// 读 session 出错了
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(&http.Cookie{Name: "sessid", Value: "error"})
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, errMockStore, logged)
+
+	// 读 token 出错了, 不能生成新的把原来的覆盖掉
+	logged = nil
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(&http.Cookie{Name: "sessid", Value: "get-error"})
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, errMockStore, logged)
+	assert.False(t, errSess.set)
+}
+
+var errMockStore = errors.New("mock store error")
+
+// errStore id 为 error 的时候模拟 redis 挂了之类的错误
+// id 为 get-error 的时候, 拿到的 Session 读数据会出错
+type errStore struct {
+	session.Store
+}
+
+func (s errStore) Get(ctx context.Context, id string) (session.Session, error) {
+	switch id {
+	case "error":
+		return nil, errMockStore
+	case "get-error":
+		return errSess, nil
+	}
+	return s.Store.Get(ctx, id)
+}
+
+var errSess = &errSession{}
+
+type errSession struct {
+	set bool
+}
+
+func (s *errSession) Get(ctx context.Context, key string) (any, error) {
+	return nil, errMockStore
+}
+
+func (s *errSession) Set(ctx context.Context, key string, val any) error {
+	s.set = true
+	return nil
+}
+
+func (s *errSession) ID() string {
+	return "get-error"
+}
+
+func TestMiddlewareBuilder_BindTo(t *testing.T) {
+	builder := NewDoubleSubmitMiddlewareBuilder([]byte("secret")).
+		BindTo(func(ctx *web.Context) string {
+			return ctx.Req.Header.Get("X-Client")
+		})
+	server := web.NewHTTPServer(web.ServerWithMiddleware(builder.Build()))
+	server.Get("/token", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, Token(ctx))
+	})
+	server.Post("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	})
+
+	// 攻击者自己拿到的合法 token
+	req := httptest.NewRequest(http.MethodGet, "/token", nil)
+	req.Header.Set("X-Client", "attacker")
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	c := recorder.Result().Cookies()[0]
+
+	do := func(client string) int {
+		req := httptest.NewRequest(http.MethodPost, "/user", nil)
+		req.Header.Set("X-Client", client)
+		req.Header.Set("X-CSRF-Token", c.Value)
+		req.AddCookie(c)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	assert.Equal(t, http.StatusOK, do("attacker"))
+	// 写到受害者的 cookie 里面也没用
+	assert.Equal(t, http.StatusForbidden, do("victim"))
+}
+
+func TestNewDoubleSubmitMiddlewareBuilder(t *testing.T) {
+	assert.Panics(t, func() {
+		NewDoubleSubmitMiddlewareBuilder(nil)
+	})
+}
@@ -2,6 +2,7 @@ package opentelemetry
 
 import (
 	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/middleware/requestid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
@@ -38,6 +39,10 @@ func (m MiddleWareBuild) Build() web.Middleware {
 
 				// 把响应码加上
 				span.SetAttributes(attribute.Int("http.status", ctx.RespStatusCode))
+				// 用请求 ID 把 span 和日志关联起来
+				if id := requestid.Get(ctx); id != "" {
+					span.SetAttributes(attribute.String("http.request_id", id))
+				}
 				span.End()
 			}()
 
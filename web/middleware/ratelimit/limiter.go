@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Limiter 限流器, key 一般是 IP 或者用户 ID
+type Limiter interface {
+	// Allow 消耗一次配额
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Result 限流的结果, 用来构造 RateLimit-* 和 Retry-After 头部
+type Result struct {
+	Allowed bool
+	// Limit 一个周期里面的总配额
+	Limit int
+	// Remaining 剩下的配额
+	Remaining int
+	// ResetAfter 多久之后配额完全恢复
+	ResetAfter time.Duration
+	// RetryAfter 被拒绝的时候, 多久之后可以重试
+	RetryAfter time.Duration
+}
+
+// checkLimit 配额和周期必须大于 0, 不然一个请求都放不过, 肯定是配置错了
+func checkLimit(limit int, period time.Duration) {
+	if limit <= 0 {
+		panic(fmt.Sprintf("web: ratelimit 的 limit 必须大于 0 [%d]", limit))
+	}
+	if period <= 0 {
+		panic(fmt.Sprintf("web: ratelimit 的周期必须大于 0 [%s]", period))
+	}
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	// 每秒 2 个, 最多攒 3 个
+	l := NewTokenBucketLimiter(2, time.Second, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 2; i >= 0; i-- {
+		res, err := l.Allow(context.Background(), "a")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, err := l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Limit: 3, RetryAfter: 500 * time.Millisecond, ResetAfter: 1500 * time.Millisecond}, res)
+
+	// 别的 key 不受影响
+	res, err = l.Allow(context.Background(), "b")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	res, err = l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// 满了的桶会被清理掉
+	now = now.Add(time.Minute)
+	_, err = l.Allow(context.Background(), "c")
+	require.NoError(t, err)
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewSlidingWindowLimiter(2, time.Second)
+	l.now = func() time.Time { return now }
+
+	res, err := l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: time.Second}, res)
+
+	now = now.Add(400 * time.Millisecond)
+	res, err = l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: time.Second}, res)
+
+	now = now.Add(400 * time.Millisecond)
+	res, err = l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Limit: 2, ResetAfter: 600 * time.Millisecond, RetryAfter: 200 * time.Millisecond}, res)
+
+	// 第一个请求滑出了窗口
+	now = now.Add(200 * time.Millisecond)
+	res, err = l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	now = now.Add(2 * time.Second)
+	_, err = l.Allow(context.Background(), "b")
+	require.NoError(t, err)
+	assert.Len(t, l.logs, 1)
+}
+
+func TestRedisSlidingWindowLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.Unix(1700000000, 0)
+	mr.SetTime(now)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	l := NewRedisSlidingWindowLimiter(client, 2, time.Second, RedisLimiterWithPrefix("test"))
+
+	res, err := l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, ResetAfter: time.Second}, res)
+
+	mr.SetTime(now.Add(400 * time.Millisecond))
+	res, err = l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: time.Second}, res)
+
+	mr.SetTime(now.Add(800 * time.Millisecond))
+	res, err = l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Limit: 2, ResetAfter: 600 * time.Millisecond, RetryAfter: 200 * time.Millisecond}, res)
+	assert.True(t, mr.Exists("test:a"))
+
+	mr.SetTime(now.Add(time.Second))
+	res, err = l.Allow(context.Background(), "a")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	mr.Close()
+	_, err = l.Allow(context.Background(), "a")
+	assert.Error(t, err)
+}
+
+func TestLimiter_InvalidLimit(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	assert.Panics(t, func() {
+		NewTokenBucketLimiter(0, time.Second, 1)
+	})
+	assert.Panics(t, func() {
+		NewTokenBucketLimiter(1, time.Second, 0)
+	})
+	assert.Panics(t, func() {
+		NewSlidingWindowLimiter(0, time.Second)
+	})
+	assert.Panics(t, func() {
+		NewSlidingWindowLimiter(1, 0)
+	})
+	assert.Panics(t, func() {
+		NewRedisSlidingWindowLimiter(client, 0, time.Second)
+	})
+}
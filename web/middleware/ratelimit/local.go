@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucketLimiter 本地的令牌桶, 每个 key 一个桶
+// 允许突发流量, 桶满了之后最多一下子放过 burst 个请求
+type TokenBucketLimiter struct {
+	// 每秒放多少个令牌
+	rate  float64
+	burst int
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	// 定期清理已经满了的桶, 防止 key 越来越多
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter 每 per 时间放 limit 个令牌, 桶的容量是 burst
+func NewTokenBucketLimiter(limit int, per time.Duration, burst int) *TokenBucketLimiter {
+	checkLimit(limit, per)
+	if burst <= 0 {
+		panic(fmt.Sprintf("web: ratelimit 的 burst 必须大于 0 [%d]", burst))
+	}
+	return &TokenBucketLimiter{
+		rate:    float64(limit) / per.Seconds(),
+		burst:   burst,
+		buckets: make(map[string]*bucket, 64),
+		now:     time.Now,
+	}
+}
+
+func (l *TokenBucketLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	res := Result{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.durationOf(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.ResetAfter = l.durationOf(float64(l.burst) - b.tokens)
+	return res, nil
+}
+
+func (l *TokenBucketLimiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// durationOf 攒够 tokens 个令牌需要的时间
+func (l *TokenBucketLimiter) durationOf(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.rate * float64(time.Second)))
+}
+
+// sweep 满了的桶和新建一个没有区别, 删掉
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// SlidingWindowLimiter 本地的滑动窗口, 任意 window 时间里面最多放过 limit 个请求
+// 记录的是每个请求的时间, 所以 limit 不适合太大
+type SlidingWindowLimiter struct {
+	limit  int
+	window time.Duration
+
+	mutex sync.Mutex
+	// 每个 key 放过的请求的时间, 从旧到新
+	logs      map[string][]time.Time
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+func NewSlidingWindowLimiter(limit int, window time.Duration) *SlidingWindowLimiter {
+	checkLimit(limit, window)
+	return &SlidingWindowLimiter{
+		limit:  limit,
+		window: window,
+		logs:   make(map[string][]time.Time, 64),
+		now:    time.Now,
+	}
+}
+
+func (l *SlidingWindowLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	log := l.expire(l.logs[key], now)
+
+	res := Result{Limit: l.limit}
+	if len(log) < l.limit {
+		log = append(log, now)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = log[0].Add(l.window).Sub(now)
+	}
+	l.logs[key] = log
+	res.Remaining = l.limit - len(log)
+	if len(log) > 0 {
+		res.ResetAfter = log[len(log)-1].Add(l.window).Sub(now)
+	}
+	return res, nil
+}
+
+// expire 去掉已经滑出窗口的请求
+func (l *SlidingWindowLimiter) expire(log []time.Time, now time.Time) []time.Time {
+	start := now.Add(-l.window)
+	i := 0
+	for i < len(log) && !log[i].After(start) {
+		i++
+	}
+	return log[i:]
+}
+
+func (l *SlidingWindowLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, log := range l.logs {
+		if len(l.expire(log, now)) == 0 {
+			delete(l.logs, key)
+		}
+	}
+}
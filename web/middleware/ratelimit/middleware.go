@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Moty1999/web/web"
+)
+
+// KeyFunc 从请求里面拿到限流的 key, 返回空字符串代表这个请求不限流
+type KeyFunc func(ctx *web.Context) string
+
+type MiddlewareBuilder struct {
+	limiter Limiter
+	keyFunc KeyFunc
+	// 限流器出错的时候, 默认放过请求, 不能因为 redis 挂了整个服务都不可用
+	failClose bool
+	logFunc   func(err error)
+}
+
+// NewMiddlewareBuilder 默认按照客户端 IP 限流
+// 每个路由单独限流的话, 在路由上注册, 每个路由用不同的 Limiter
+func NewMiddlewareBuilder(limiter Limiter) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		limiter: limiter,
+		keyFunc: KeyByIP,
+		logFunc: func(err error) {
+			fmt.Printf("ratelimit: 限流器出错 %v\n", err)
+		},
+	}
+}
+
+func (m *MiddlewareBuilder) KeyFunc(fn KeyFunc) *MiddlewareBuilder {
+	m.keyFunc = fn
+	return m
+}
+
+// FailClose 限流器出错的时候拒绝请求, 返回 503
+func (m *MiddlewareBuilder) FailClose() *MiddlewareBuilder {
+	m.failClose = true
+	return m
+}
+
+func (m *MiddlewareBuilder) LogFunc(fn func(err error)) *MiddlewareBuilder {
+	m.logFunc = fn
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			key := m.keyFunc(ctx)
+			if key == "" {
+				next(ctx)
+				return
+			}
+			res, err := m.limiter.Allow(ctx.Req.Context(), key)
+			if err != nil {
+				m.logFunc(err)
+				if m.failClose {
+					ctx.RespStatusCode = http.StatusServiceUnavailable
+					ctx.RespData = []byte("Service Unavailable")
+					return
+				}
+				next(ctx)
+				return
+			}
+
+			header := ctx.Resp.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", seconds(res.ResetAfter))
+			if !res.Allowed {
+				header.Set("Retry-After", seconds(res.RetryAfter))
+				ctx.RespStatusCode = http.StatusTooManyRequests
+				ctx.RespData = []byte("Too Many Requests")
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// seconds 头部里面的单位是秒, 向上取整, 不然客户端会过早重试
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// KeyByIP 用的是 RemoteAddr, 不信任 X-Forwarded-For
+// 在代理后面的话, 用 KeyByHeader("X-Real-IP") 之类的, 并且确保这个头部是代理设置的
+func KeyByIP(ctx *web.Context) string {
+	host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+	if err != nil {
+		return ctx.Req.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader 例如按照 API key 限流, 没有这个头部的请求不限流
+func KeyByHeader(name string) KeyFunc {
+	return func(ctx *web.Context) string {
+		return ctx.Req.Header.Get(name)
+	}
+}
+
+// KeyByUserValue 按照前面的中间件放在 UserValues 里面的值限流, 例如 session 里面的用户 ID
+func KeyByUserValue(key string) KeyFunc {
+	return func(ctx *web.Context) string {
+		val, ok := ctx.UserValues[key]
+		if !ok {
+			return ""
+		}
+		return fmt.Sprint(val)
+	}
+}
+
+// KeyWithPath 给 key 加上方法和路由, 这样每个接口的配额是分开的
+// 用的是命中的路由, 例如 /user/:id, 不然换个 id 就能绕过限流, key 也会越来越多
+// 还没有匹配到路由的时候(例如作为全局中间件), 退回到请求路径
+func KeyWithPath(fn KeyFunc) KeyFunc {
+	return func(ctx *web.Context) string {
+		key := fn(ctx)
+		if key == "" {
+			return ""
+		}
+		route := ctx.MatchedRoute
+		if route == "" {
+			route = ctx.Req.URL.Path
+		}
+		return ctx.Req.Method + " " + route + ":" + key
+	}
+}
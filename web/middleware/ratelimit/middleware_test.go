@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web"
+	"github.com/stretchr/testify/assert"
+)
+
+type errLimiter struct{}
+
+func (errLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return Result{}, errors.New("mock error")
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewSlidingWindowLimiter(1, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	server := web.NewHTTPServer()
+	server.Get("/user", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "user")
+	})
+	server.Use(http.MethodGet, "/user",
+		NewMiddlewareBuilder(limiter).KeyFunc(KeyWithPath(KeyByHeader("X-API-Key"))).Build())
+	server.Get("/ip", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "ip")
+	})
+	server.Use(http.MethodGet, "/ip", NewMiddlewareBuilder(NewTokenBucketLimiter(1, time.Minute, 1)).Build())
+	server.Get("/fail-open", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	})
+	server.Use(http.MethodGet, "/fail-open", NewMiddlewareBuilder(errLimiter{}).LogFunc(func(err error) {}).Build())
+	server.Get("/fail-close", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	})
+	server.Use(http.MethodGet, "/fail-close", NewMiddlewareBuilder(errLimiter{}).LogFunc(func(err error) {}).FailClose().Build())
+
+	testCases := []struct {
+		name       string
+		path       string
+		apiKey     string
+		remoteAddr string
+		wantCode   int
+		wantHeader map[string]string
+	}{
+		{
+			name:     "no key",
+			path:     "/user",
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"RateLimit-Limit": "",
+			},
+		},
+		{
+			name:     "first",
+			path:     "/user",
+			apiKey:   "k1",
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"RateLimit-Limit":     "1",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "60",
+				"Retry-After":         "",
+			},
+		},
+		{
+			name:     "limited",
+			path:     "/user",
+			apiKey:   "k1",
+			wantCode: http.StatusTooManyRequests,
+			wantHeader: map[string]string{
+				"RateLimit-Limit":     "1",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "60",
+				"Retry-After":         "60",
+			},
+		},
+		{
+			name:     "other key",
+			path:     "/user",
+			apiKey:   "k2",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "ip",
+			path:       "/ip",
+			remoteAddr: "10.0.0.1:1234",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "same ip other port",
+			path:       "/ip",
+			remoteAddr: "10.0.0.1:5678",
+			wantCode:   http.StatusTooManyRequests,
+			wantHeader: map[string]string{
+				"Retry-After": "60",
+			},
+		},
+		{
+			name:       "other ip",
+			path:       "/ip",
+			remoteAddr: "10.0.0.2:1234",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:     "fail open",
+			path:     "/fail-open",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "fail close",
+			path:     "/fail-close",
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			for key, val := range tc.wantHeader {
+				assert.Equal(t, val, recorder.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func TestKeyByUserValue(t *testing.T) {
+	ctx := &web.Context{UserValues: map[string]any{"uid": 123}}
+	assert.Equal(t, "123", KeyByUserValue("uid")(ctx))
+	assert.Equal(t, "", KeyByUserValue("none")(ctx))
+}
+
+func TestKeyWithPath(t *testing.T) {
+	server := web.NewHTTPServer()
+	server.Get("/user/:id", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, "user")
+	})
+	// 一分钟只放过一个请求
+	server.Use(http.MethodGet, "/user/:id", NewMiddlewareBuilder(NewSlidingWindowLimiter(1, time.Minute)).
+		KeyFunc(KeyWithPath(KeyByIP)).Build())
+
+	// 按照路由限流, 换一个 id 也绕不过去
+	codes := make([]int, 0, 2)
+	for _, path := range []string{"/user/1", "/user/2"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		codes = append(codes, recorder.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests}, codes)
+
+	// 没有匹配到路由的时候用请求路径
+	ctx := &web.Context{Req: httptest.NewRequest(http.MethodGet, "/order/1", nil)}
+	ctx.Req.RemoteAddr = "1.2.3.4:5678"
+	assert.Equal(t, "GET /order/1:1.2.3.4", KeyWithPath(KeyByIP)(ctx))
+	ctx.MatchedRoute = "/order/:id"
+	assert.Equal(t, "GET /order/:id:1.2.3.4", KeyWithPath(KeyByIP)(ctx))
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindowScript 用有序集合记录每个请求的时间, 分数是毫秒
+// 时间用的是 redis 的 TIME, 多个实例的时钟不一致也没关系, 需要 redis 5 以上
+// 返回 {是否放过, 剩余配额, 多久之后完全恢复, 多久之后可以重试}
+const slidingWindowScript = `
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local cnt = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if cnt < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[3])
+	redis.call("PEXPIRE", KEYS[1], window)
+	cnt = cnt + 1
+	allowed = 1
+end
+
+local reset = 0
+local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+if #newest > 0 then
+	reset = tonumber(newest[2]) + window - now
+end
+local retry = 0
+if allowed == 0 then
+	local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+	if #oldest > 0 then
+		retry = tonumber(oldest[2]) + window - now
+	end
+end
+return {allowed, limit - cnt, reset, retry}
+`
+
+// RedisSlidingWindowLimiter 基于 redis 的滑动窗口, 多个实例共享配额
+// 判断和计数在一个 lua 脚本里面完成, 所以是原子的
+type RedisSlidingWindowLimiter struct {
+	client redis.Cmdable
+	script *redis.Script
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+type RedisLimiterOption func(l *RedisSlidingWindowLimiter)
+
+func RedisLimiterWithPrefix(prefix string) RedisLimiterOption {
+	return func(l *RedisSlidingWindowLimiter) {
+		l.prefix = prefix
+	}
+}
+
+func NewRedisSlidingWindowLimiter(client redis.Cmdable, limit int, window time.Duration,
+	opts ...RedisLimiterOption) *RedisSlidingWindowLimiter {
+	checkLimit(limit, window)
+	res := &RedisSlidingWindowLimiter{
+		client: client,
+		script: redis.NewScript(slidingWindowScript),
+		prefix: "ratelimit",
+		limit:  limit,
+		window: window,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (l *RedisSlidingWindowLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	// 同一毫秒里面可能有多个请求, 成员要唯一
+	vals, err := l.script.Run(ctx, l.client, []string{l.prefix + ":" + key},
+		l.window.Milliseconds(), l.limit, uuid.NewString()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{
+		Allowed:    vals[0] == 1,
+		Limit:      l.limit,
+		Remaining:  int(vals[1]),
+		ResetAfter: time.Duration(vals[2]) * time.Millisecond,
+	}
+	if !res.Allowed {
+		res.RetryAfter = time.Duration(vals[3]) * time.Millisecond
+	}
+	return res, nil
+}
@@ -1,12 +1,20 @@
 package recover
 
-import "github.com/Moty1999/web/web"
+import (
+	"fmt"
+
+	"github.com/Moty1999/web/web"
+)
 
 type MiddlewareBuilder struct {
 	StatusCode int
 	Data       []byte
 	//log func(err any)
+	// Log 和 LogPanic 都为 nil 的话, 打印 panic 的路径和请求 ID
 	Log func(ctx *web.Context)
+	// LogPanic 设置了的话优先用它, err 是 panic 的值
+	// 用了 requestid 中间件的话, 可以用 requestid.FromContext(ctx.Req.Context()) 拿到请求 ID
+	LogPanic func(ctx *web.Context, err any)
 	//log func(stack string)
 }
 
@@ -17,7 +25,17 @@ func (m MiddlewareBuilder) Build() web.Middleware {
 				if err := recover(); err != nil {
 					ctx.RespData = m.Data
 					ctx.RespStatusCode = m.StatusCode
-					m.Log(ctx)
+					if m.LogPanic != nil {
+						m.LogPanic(ctx, err)
+						return
+					}
+					if m.Log != nil {
+						m.Log(ctx)
+						return
+					}
+					// 用了 requestid 中间件的话, 响应头里面有请求 ID, 可以根据它找到这条日志
+					fmt.Printf("recover: panic %v, 路径 %s, 请求 ID %s\n",
+						err, ctx.Req.URL.Path, ctx.Resp.Header().Get("X-Request-ID"))
 				}
 			}()
 			next(ctx)
@@ -3,6 +3,10 @@ package recover
 import (
 	"fmt"
 	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -21,3 +25,37 @@ func TestMiddlewareBuilder_Build(t *testing.T) {
 	})
 	server.Start(":8081")
 }
+
+func TestMiddlewareBuilder_LogPanic(t *testing.T) {
+	var (
+		gotErr any
+		gotID  string
+		logged bool
+	)
+	builder := MiddlewareBuilder{
+		StatusCode: http.StatusInternalServerError,
+		Data:       []byte("你 panic 了"),
+		Log: func(ctx *web.Context) {
+			logged = true
+		},
+		LogPanic: func(ctx *web.Context, err any) {
+			gotErr, gotID = err, requestid.FromContext(ctx.Req.Context())
+		},
+	}
+	server := web.NewHTTPServer(web.ServerWithMiddleware(
+		requestid.NewMiddlewareBuilder().Build(), builder.Build()))
+	server.Get("/user", func(ctx *web.Context) {
+		panic("发生了 panic 了")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("X-Request-ID", "abc")
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "你 panic 了", recorder.Body.String())
+	assert.Equal(t, "发生了 panic 了", gotErr)
+	assert.Equal(t, "abc", gotID)
+	// 设置了 LogPanic 就不会再调用 Log
+	assert.False(t, logged)
+}
@@ -0,0 +1,97 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/Moty1999/web/web"
+	"github.com/google/uuid"
+)
+
+// UserValueKey 请求 ID 在 ctx.UserValues 里面的 key
+const UserValueKey = "request_id"
+
+// 放到 ctx.Req.Context() 里面用的 key, 这样 orm 之类拿不到 web.Context 的地方也能拿到请求 ID
+type ctxKey struct{}
+
+// 请求 ID 最长多少, 太长的或者有奇怪字符的不要, 防止日志注入
+const maxLength = 128
+
+type MiddlewareBuilder struct {
+	header    string
+	generator func() string
+}
+
+// NewMiddlewareBuilder 默认用 X-Request-ID 这个头部, 没有的话生成一个 uuid
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		header:    "X-Request-ID",
+		generator: uuid.NewString,
+	}
+}
+
+// Header 读和写的头部
+func (m *MiddlewareBuilder) Header(name string) *MiddlewareBuilder {
+	m.header = name
+	return m
+}
+
+// Generator 请求里面没有请求 ID 的时候, 用它生成一个
+func (m *MiddlewareBuilder) Generator(fn func() string) *MiddlewareBuilder {
+	m.generator = fn
+	return m
+}
+
+// Build 放在尽可能前面, 这样 accesslog 和 recover 之类的中间件都能拿到请求 ID
+// accesslog 和 recover 是在 next 返回之后才读的, 所以放在它们后面也可以
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			id := ctx.Req.Header.Get(m.header)
+			if !valid(id) {
+				id = m.generator()
+			}
+			if ctx.UserValues == nil {
+				ctx.UserValues = make(map[string]any, 4)
+			}
+			ctx.UserValues[UserValueKey] = id
+			ctx.Req = ctx.Req.WithContext(NewContext(ctx.Req.Context(), id))
+			// 先设置好, 后面不管是正常返回还是 panic 了, 响应里面都有
+			ctx.Resp.Header().Set(m.header, id)
+			next(ctx)
+		}
+	}
+}
+
+// Get 拿到请求 ID, 没有用 requestid 中间件的话返回空字符串
+func Get(ctx *web.Context) string {
+	if id, ok := ctx.UserValues[UserValueKey].(string); ok {
+		return id
+	}
+	if ctx.Req == nil {
+		return ""
+	}
+	return FromContext(ctx.Req.Context())
+}
+
+// NewContext 把请求 ID 放到 context 里面, 例如发起下游请求的时候带上
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		// 只接受可见的 ASCII 字符
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Moty1999/web/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	server := web.NewHTTPServer(web.ServerWithMiddleware(
+		NewMiddlewareBuilder().Generator(func() string {
+			return "generated"
+		}).Build()))
+	server.Get("/user", func(ctx *web.Context) {
+		// web.Context 和请求的 context 里面都有
+		ctx.RespString(http.StatusOK, Get(ctx)+","+FromContext(ctx.Req.Context()))
+	})
+
+	testCases := []struct {
+		name     string
+		reqID    string
+		wantBody string
+		wantID   string
+	}{
+		{
+			name:     "generate",
+			wantBody: "generated,generated",
+			wantID:   "generated",
+		},
+		{
+			name:     "incoming",
+			reqID:    "abc-123",
+			wantBody: "abc-123,abc-123",
+			wantID:   "abc-123",
+		},
+		{
+			name:     "invalid char",
+			reqID:    "abc\x01",
+			wantBody: "generated,generated",
+			wantID:   "generated",
+		},
+		{
+			name:     "too long",
+			reqID:    strings.Repeat("a", 129),
+			wantBody: "generated,generated",
+			wantID:   "generated",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			if tc.reqID != "" {
+				req.Header.Set("X-Request-ID", tc.reqID)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantID, recorder.Header().Get("X-Request-ID"))
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	assert.Equal(t, "", Get(&web.Context{Req: req}))
+	assert.Equal(t, "", Get(&web.Context{}))
+
+	req = req.WithContext(NewContext(context.Background(), "ctx"))
+	assert.Equal(t, "ctx", Get(&web.Context{Req: req}))
+	assert.Equal(t, "user", Get(&web.Context{Req: req, UserValues: map[string]any{UserValueKey: "user"}}))
+}
@@ -0,0 +1,97 @@
+package secure
+
+import "strings"
+
+// Nonce CSP 里面的占位符, 每个请求会替换成 'nonce-xxx'
+const Nonce = "'nonce'"
+
+// CSP Content-Security-Policy 的构造器, 指令按照添加的顺序输出
+type CSP struct {
+	names   []string
+	sources map[string][]string
+}
+
+// NewCSP 默认只允许同源的资源, 内联的脚本和样式要带上 nonce
+func NewCSP() *CSP {
+	return (&CSP{sources: make(map[string][]string, 8)}).
+		Directive("default-src", "'self'").
+		Directive("script-src", "'self'", Nonce).
+		Directive("style-src", "'self'", Nonce).
+		Directive("img-src", "'self'", "data:").
+		Directive("object-src", "'none'").
+		Directive("base-uri", "'self'").
+		Directive("form-action", "'self'").
+		Directive("frame-ancestors", "'none'")
+}
+
+// Directive 设置一个指令, 会覆盖掉原来的, 没有 sources 的话就是 upgrade-insecure-requests 这种
+func (c *CSP) Directive(name string, sources ...string) *CSP {
+	if _, ok := c.sources[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.sources[name] = sources
+	return c
+}
+
+// Add 在原有的指令后面追加, 例如允许某个 CDN
+func (c *CSP) Add(name string, sources ...string) *CSP {
+	return c.Directive(name, append(c.sources[name], sources...)...)
+}
+
+// Remove 删掉一个指令
+func (c *CSP) Remove(name string) *CSP {
+	if _, ok := c.sources[name]; !ok {
+		return c
+	}
+	delete(c.sources, name)
+	for i, n := range c.names {
+		if n == name {
+			c.names = append(c.names[:i:i], c.names[i+1:]...)
+			break
+		}
+	}
+	return c
+}
+
+// Clone 复制一份, 给某个路由改一改
+func (c *CSP) Clone() *CSP {
+	res := &CSP{sources: make(map[string][]string, len(c.sources))}
+	for _, name := range c.names {
+		res.Directive(name, append([]string(nil), c.sources[name]...)...)
+	}
+	return res
+}
+
+// usesNonce 用了占位符才需要生成 nonce
+func (c *CSP) usesNonce() bool {
+	for _, srcs := range c.sources {
+		for _, src := range srcs {
+			if src == Nonce {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String 把占位符替换成 nonce, nonce 为空的话去掉占位符
+func (c *CSP) String(nonce string) string {
+	var sb strings.Builder
+	for i, name := range c.names {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(name)
+		for _, src := range c.sources[name] {
+			if src == Nonce {
+				if nonce == "" {
+					continue
+				}
+				src = "'nonce-" + nonce + "'"
+			}
+			sb.WriteByte(' ')
+			sb.WriteString(src)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,58 @@
+package secure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSP_String(t *testing.T) {
+	testCases := []struct {
+		name  string
+		csp   *CSP
+		nonce string
+		want  string
+	}{
+		{
+			name:  "default",
+			csp:   NewCSP(),
+			nonce: "abc",
+			want: "default-src 'self'; script-src 'self' 'nonce-abc'; style-src 'self' 'nonce-abc'; " +
+				"img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'",
+		},
+		{
+			name: "no nonce",
+			csp:  (&CSP{sources: map[string][]string{}}).Directive("script-src", "'self'", Nonce),
+			want: "script-src 'self'",
+		},
+		{
+			name: "add, override and remove",
+			csp: (&CSP{sources: map[string][]string{}}).
+				Directive("default-src", "'none'").
+				Directive("script-src", "'self'").
+				Add("script-src", "https://cdn.example.com").
+				Directive("default-src", "'self'").
+				Directive("upgrade-insecure-requests").
+				Remove("img-src").
+				Add("img-src", "*").
+				Remove("img-src"),
+			want: "default-src 'self'; script-src 'self' https://cdn.example.com; upgrade-insecure-requests",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.csp.String(tc.nonce))
+		})
+	}
+}
+
+func TestCSP_Clone(t *testing.T) {
+	csp := NewCSP()
+	cp := csp.Clone().Add("script-src", "https://cdn.example.com").Remove("frame-ancestors")
+	assert.Equal(t, []string{"'self'", Nonce}, csp.sources["script-src"])
+	assert.Contains(t, csp.String(""), "frame-ancestors 'none'")
+	assert.Equal(t, []string{"'self'", Nonce, "https://cdn.example.com"}, cp.sources["script-src"])
+	assert.NotContains(t, cp.String(""), "frame-ancestors")
+	assert.True(t, csp.usesNonce())
+	assert.False(t, NewCSP().Directive("script-src", "'self'").Directive("style-src", "'self'").usesNonce())
+}
@@ -0,0 +1,185 @@
+package secure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"html/template"
+	"strconv"
+	"time"
+
+	"github.com/Moty1999/web/web"
+)
+
+// nonce 在 ctx.UserValues 里面的 key
+const nonceKey = "csp_nonce"
+
+// 放到 ctx.Req.Context() 里面用的 key, 模板函数只能拿到这个
+type ctxKey struct{}
+
+// MiddlewareBuilder 设置安全相关的响应头, 默认值都是比较严格的
+// 某个路由要放宽的话, 用 Clone 复制一份改掉, 注册在那个路由上, 会覆盖掉全局的设置, nonce 不会变
+// 设置成空字符串的头部会被删掉
+type MiddlewareBuilder struct {
+	hsts              string
+	forceHSTS         bool
+	contentTypeOpts   string
+	frameOptions      string
+	referrerPolicy    string
+	permissionsPolicy string
+	csp               *CSP
+	cspReportOnly     bool
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return (&MiddlewareBuilder{
+		contentTypeOpts:   "nosniff",
+		frameOptions:      "DENY",
+		referrerPolicy:    "strict-origin-when-cross-origin",
+		permissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=()",
+		csp:               NewCSP(),
+	}).HSTS(2*365*24*time.Hour, true, false)
+}
+
+// HSTS maxAge 为 0 的话不设置
+// 只有 HTTPS 的请求才会设置, 在代理后面的话用 ForceHSTS
+func (m *MiddlewareBuilder) HSTS(maxAge time.Duration, includeSubDomains, preload bool) *MiddlewareBuilder {
+	if maxAge <= 0 {
+		m.hsts = ""
+		return m
+	}
+	m.hsts = "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	if includeSubDomains {
+		m.hsts += "; includeSubDomains"
+	}
+	if preload {
+		m.hsts += "; preload"
+	}
+	return m
+}
+
+// ForceHSTS HTTP 的请求也设置 HSTS, 例如 TLS 是在代理上终止的
+func (m *MiddlewareBuilder) ForceHSTS() *MiddlewareBuilder {
+	m.forceHSTS = true
+	return m
+}
+
+// ContentTypeOptions X-Content-Type-Options, 默认 nosniff
+func (m *MiddlewareBuilder) ContentTypeOptions(val string) *MiddlewareBuilder {
+	m.contentTypeOpts = val
+	return m
+}
+
+// FrameOptions X-Frame-Options, 默认 DENY
+func (m *MiddlewareBuilder) FrameOptions(val string) *MiddlewareBuilder {
+	m.frameOptions = val
+	return m
+}
+
+// ReferrerPolicy 默认 strict-origin-when-cross-origin
+func (m *MiddlewareBuilder) ReferrerPolicy(val string) *MiddlewareBuilder {
+	m.referrerPolicy = val
+	return m
+}
+
+// PermissionsPolicy 默认禁用摄像头, 麦克风, 定位和支付
+func (m *MiddlewareBuilder) PermissionsPolicy(val string) *MiddlewareBuilder {
+	m.permissionsPolicy = val
+	return m
+}
+
+// CSP 为 nil 的话不设置 Content-Security-Policy
+func (m *MiddlewareBuilder) CSP(csp *CSP) *MiddlewareBuilder {
+	m.csp = csp
+	return m
+}
+
+// CSPReportOnly 用 Content-Security-Policy-Report-Only, 上线新策略之前先观察一下
+func (m *MiddlewareBuilder) CSPReportOnly() *MiddlewareBuilder {
+	m.cspReportOnly = true
+	return m
+}
+
+// Clone 复制一份, 给某个路由单独设置
+func (m *MiddlewareBuilder) Clone() *MiddlewareBuilder {
+	res := *m
+	if m.csp != nil {
+		res.csp = m.csp.Clone()
+	}
+	return &res
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			header := ctx.Resp.Header()
+			set := func(key, val string) {
+				if val == "" {
+					header.Del(key)
+					return
+				}
+				header.Set(key, val)
+			}
+			if ctx.Req.TLS != nil || m.forceHSTS {
+				set("Strict-Transport-Security", m.hsts)
+			}
+			set("X-Content-Type-Options", m.contentTypeOpts)
+			set("X-Frame-Options", m.frameOptions)
+			set("Referrer-Policy", m.referrerPolicy)
+			set("Permissions-Policy", m.permissionsPolicy)
+
+			header.Del("Content-Security-Policy")
+			header.Del("Content-Security-Policy-Report-Only")
+			if m.csp != nil {
+				var nonce string
+				if m.csp.usesNonce() {
+					nonce = nonceOf(ctx)
+				}
+				key := "Content-Security-Policy"
+				if m.cspReportOnly {
+					key = "Content-Security-Policy-Report-Only"
+				}
+				header.Set(key, m.csp.String(nonce))
+			}
+			next(ctx)
+		}
+	}
+}
+
+// nonceOf 同一个请求只生成一次, 全局和路由上的中间件用的是同一个
+func nonceOf(ctx *web.Context) string {
+	if nonce := NonceOf(ctx); nonce != "" {
+		return nonce
+	}
+	data := make([]byte, 16)
+	// crypto/rand 出错基本上意味着系统有问题了
+	if _, err := rand.Read(data); err != nil {
+		panic(err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(data)
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 4)
+	}
+	ctx.UserValues[nonceKey] = nonce
+	ctx.Req = ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), ctxKey{}, nonce))
+	return nonce
+}
+
+// NonceOf 当前请求的 CSP nonce, 没有的话返回空字符串
+func NonceOf(ctx *web.Context) string {
+	nonce, _ := ctx.UserValues[nonceKey].(string)
+	return nonce
+}
+
+func NonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(ctxKey{}).(string)
+	return nonce
+}
+
+// FuncMap 模板函数, 参数是请求的 context, web.GoTemplateEngine 会把它放到 .Ctx 里面
+// 模板里面 <script nonce="{{ cspNonce .Ctx }}">, 和别的中间件一起用参考 web.GoTemplateEngine
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": NonceFromContext,
+	}
+}
@@ -0,0 +1,112 @@
+package secure
+
+import (
+	"crypto/tls"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	builder := NewMiddlewareBuilder()
+	tpl, err := template.New("page").Funcs(FuncMap()).Parse(`<script nonce="{{ cspNonce .Ctx }}"></script>`)
+	require.NoError(t, err)
+	server := web.NewHTTPServer(
+		web.ServerWithMiddleware(builder.Build()),
+		web.ServerWithTemplateEngine(&web.GoTemplateEngine{T: tpl}))
+	server.Get("/page", func(ctx *web.Context) {
+		_ = ctx.Render("page", nil)
+	})
+	server.Get("/nonce", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, NonceOf(ctx))
+	})
+	// 嵌到别的页面里面的组件, 放宽 frame 相关的限制, 允许一个 CDN
+	server.Get("/embed", func(ctx *web.Context) {
+		ctx.RespString(http.StatusOK, NonceOf(ctx))
+	})
+	server.Use(http.MethodGet, "/embed", builder.Clone().
+		FrameOptions("").
+		CSP(NewCSP().Directive("frame-ancestors", "https://example.com").Add("script-src", "https://cdn.example.com")).
+		Build())
+	server.Get("/report", func(ctx *web.Context) {})
+	server.Use(http.MethodGet, "/report", builder.Clone().CSPReportOnly().HSTS(time.Hour, false, true).Build())
+	server.Get("/no-csp", func(ctx *web.Context) {})
+	server.Use(http.MethodGet, "/no-csp", builder.Clone().CSP(nil).HSTS(0, false, false).Build())
+
+	// 默认的
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/page", nil))
+	header := recorder.Header()
+	assert.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", header.Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", header.Get("Referrer-Policy"))
+	assert.Equal(t, "camera=(), microphone=(), geolocation=(), payment=()", header.Get("Permissions-Policy"))
+	// HTTP 的请求不设置 HSTS
+	assert.Empty(t, header.Get("Strict-Transport-Security"))
+	csp := header.Get("Content-Security-Policy")
+	nonce := regexp.MustCompile(`script-src 'self' 'nonce-([^']+)'`).FindStringSubmatch(csp)
+	require.Len(t, nonce, 2)
+	assert.Equal(t, `<script nonce="`+nonce[1]+`"></script>`, recorder.Body.String())
+
+	// 每个请求的 nonce 都不一样
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/nonce", nil))
+	assert.NotEqual(t, nonce[1], recorder.Body.String())
+	assert.Contains(t, recorder.Header().Get("Content-Security-Policy"), "'nonce-"+recorder.Body.String()+"'")
+
+	// HTTPS
+	req := httptest.NewRequest(http.MethodGet, "/nonce", nil)
+	req.TLS = &tls.ConnectionState{}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, "max-age=63072000; includeSubDomains", recorder.Header().Get("Strict-Transport-Security"))
+
+	// 路由上的覆盖掉全局的, nonce 还是同一个
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/embed", nil))
+	header = recorder.Header()
+	assert.Empty(t, header.Values("X-Frame-Options"))
+	assert.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+	assert.Len(t, header.Values("Content-Security-Policy"), 1)
+	assert.Contains(t, header.Get("Content-Security-Policy"),
+		"script-src 'self' 'nonce-"+recorder.Body.String()+"' https://cdn.example.com")
+	assert.Contains(t, header.Get("Content-Security-Policy"), "frame-ancestors https://example.com")
+
+	req = httptest.NewRequest(http.MethodGet, "/report", nil)
+	req.TLS = &tls.ConnectionState{}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	header = recorder.Header()
+	assert.Empty(t, header.Get("Content-Security-Policy"))
+	assert.NotEmpty(t, header.Get("Content-Security-Policy-Report-Only"))
+	assert.Equal(t, "max-age=3600; preload", header.Get("Strict-Transport-Security"))
+
+	req = httptest.NewRequest(http.MethodGet, "/no-csp", nil)
+	req.TLS = &tls.ConnectionState{}
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	header = recorder.Header()
+	assert.Empty(t, header.Get("Content-Security-Policy"))
+	assert.Empty(t, header.Get("Strict-Transport-Security"))
+	assert.Equal(t, "DENY", header.Get("X-Frame-Options"))
+}
+
+func TestMiddlewareBuilder_ForceHSTS(t *testing.T) {
+	server := web.NewHTTPServer(web.ServerWithMiddleware(
+		NewMiddlewareBuilder().ForceHSTS().CSP(NewCSP().Directive("script-src", "'self'").Remove("style-src")).Build()))
+	server.Get("/user", func(ctx *web.Context) {
+		// 没有用到 nonce 就不生成
+		ctx.RespString(http.StatusOK, NonceOf(ctx))
+	})
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, "max-age=63072000; includeSubDomains", recorder.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, recorder.Body.String())
+}
@@ -0,0 +1,102 @@
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Moty1999/web/web"
+)
+
+// MiddlewareBuilder 给请求加上超时, 超时之后直接返回, 不等 handler
+// handler 要通过 ctx.Req.Context() 感知超时, 例如传给 orm 的 Get 和 Exec, 这样查询也会被取消
+// 每个路由的超时时间不一样的话, 在路由上注册不同的 MiddlewareBuilder
+// 不适合 Stream 和 WebSocket, 它们的输出会被缓存起来
+type MiddlewareBuilder struct {
+	timeout    time.Duration
+	statusCode int
+	// 从请求头里面读超时时间, 最多 maxTimeout
+	header     string
+	maxTimeout time.Duration
+}
+
+// NewMiddlewareBuilder 超时之后默认返回 504
+func NewMiddlewareBuilder(timeout time.Duration) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		timeout:    timeout,
+		statusCode: http.StatusGatewayTimeout,
+	}
+}
+
+// FromHeader 允许客户端通过请求头缩短或者延长超时时间, 例如 X-Timeout: 500ms
+// 可以是 time.ParseDuration 能解析的格式, 也可以是整数毫秒, 最多 max, max 为 0 的话就是默认的超时时间
+func (m *MiddlewareBuilder) FromHeader(name string, max time.Duration) *MiddlewareBuilder {
+	m.header = name
+	m.maxTimeout = max
+	return m
+}
+
+// StatusCode 超时之后返回的响应码, 一般是 503 或者 504
+func (m *MiddlewareBuilder) StatusCode(code int) *MiddlewareBuilder {
+	m.statusCode = code
+	return m
+}
+
+func (m MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			tctx, cancel := context.WithTimeout(ctx.Req.Context(), m.timeoutOf(ctx))
+			defer cancel()
+
+			// handler 在另外一个 goroutine 里面跑, 用的是 Detach 出来的 Context
+			// 超时之后它还在写的话, 写的也是自己的, 不会影响到响应
+			child := ctx.Detach(tctx)
+			done := make(chan any, 1)
+			go func() {
+				defer func() {
+					done <- recover()
+				}()
+				next(child)
+			}()
+
+			select {
+			case p := <-done:
+				// panic 交给外面的 recover 中间件处理
+				if p != nil {
+					panic(p)
+				}
+				ctx.Merge(child)
+			case <-tctx.Done():
+				ctx.RespStatusCode = m.statusCode
+				ctx.RespData = []byte(http.StatusText(m.statusCode))
+			}
+		}
+	}
+}
+
+func (m MiddlewareBuilder) timeoutOf(ctx *web.Context) time.Duration {
+	if m.header == "" {
+		return m.timeout
+	}
+	val := ctx.Req.Header.Get(m.header)
+	if val == "" {
+		return m.timeout
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		ms, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return m.timeout
+		}
+		d = time.Duration(ms) * time.Millisecond
+	}
+	if d <= 0 {
+		return m.timeout
+	}
+	maxTimeout := m.maxTimeout
+	if maxTimeout == 0 {
+		maxTimeout = m.timeout
+	}
+	return min(d, maxTimeout)
+}
@@ -0,0 +1,148 @@
+package timeout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/middleware/recover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	server := web.NewHTTPServer(web.ServerWithMiddleware(recover.MiddlewareBuilder{
+		StatusCode: http.StatusInternalServerError,
+		Data:       []byte("panic"),
+		Log:        func(ctx *web.Context) {},
+	}.Build()))
+
+	server.Get("/fast", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("X-Handler", "fast")
+		ctx.RespString(http.StatusCreated, "fast")
+	})
+	server.Use(http.MethodGet, "/fast", NewMiddlewareBuilder(time.Second).Build())
+
+	// 超时之后 handler 还在写, 这些都要被丢掉
+	late := make(chan struct{})
+	server.Get("/slow", func(ctx *web.Context) {
+		<-ctx.Req.Context().Done()
+		ctx.Resp.Header().Set("X-Handler", "slow")
+		ctx.RespString(http.StatusOK, "slow")
+		close(late)
+	})
+	server.Use(http.MethodGet, "/slow", NewMiddlewareBuilder(10*time.Millisecond).Build())
+
+	server.Get("/header", func(ctx *web.Context) {
+		select {
+		case <-ctx.Req.Context().Done():
+		case <-time.After(time.Second):
+			ctx.RespString(http.StatusOK, "ok")
+		}
+	})
+	server.Use(http.MethodGet, "/header", NewMiddlewareBuilder(5*time.Second).
+		FromHeader("X-Timeout", 0).StatusCode(http.StatusServiceUnavailable).Build())
+
+	server.Get("/deadline", func(ctx *web.Context) {
+		deadline, ok := ctx.Req.Context().Deadline()
+		if ok && time.Until(deadline) <= time.Minute {
+			ctx.RespString(http.StatusOK, "deadline")
+		}
+	})
+	server.Use(http.MethodGet, "/deadline", NewMiddlewareBuilder(time.Minute).Build())
+
+	server.Get("/panic", func(ctx *web.Context) {
+		panic("panic")
+	})
+	server.Use(http.MethodGet, "/panic", NewMiddlewareBuilder(time.Second).Build())
+
+	testCases := []struct {
+		name       string
+		path       string
+		header     map[string]string
+		wantCode   int
+		wantBody   string
+		wantHeader string
+	}{
+		{
+			name:       "fast",
+			path:       "/fast",
+			wantCode:   http.StatusCreated,
+			wantBody:   "fast",
+			wantHeader: "fast",
+		},
+		{
+			name:     "timeout",
+			path:     "/slow",
+			wantCode: http.StatusGatewayTimeout,
+			wantBody: "Gateway Timeout",
+		},
+		{
+			name:     "timeout from header",
+			path:     "/header",
+			header:   map[string]string{"X-Timeout": "10ms"},
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "Service Unavailable",
+		},
+		{
+			name:     "timeout from header in ms",
+			path:     "/header",
+			header:   map[string]string{"X-Timeout": "10"},
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "Service Unavailable",
+		},
+		{
+			name:     "deadline",
+			path:     "/deadline",
+			wantCode: http.StatusOK,
+			wantBody: "deadline",
+		},
+		{
+			name:     "panic",
+			path:     "/panic",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "panic",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for key, val := range tc.header {
+				req.Header.Set(key, val)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantHeader, recorder.Header().Get("X-Handler"))
+		})
+	}
+	<-late
+}
+
+func TestMiddlewareBuilder_timeoutOf(t *testing.T) {
+	m := NewMiddlewareBuilder(time.Second).FromHeader("X-Timeout", 3*time.Second)
+	testCases := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "no header", want: time.Second},
+		{name: "duration", header: "500ms", want: 500 * time.Millisecond},
+		{name: "ms", header: "2000", want: 2 * time.Second},
+		{name: "max", header: "1m", want: 3 * time.Second},
+		{name: "invalid", header: "abc", want: time.Second},
+		{name: "negative", header: "-1s", want: time.Second},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("X-Timeout", tc.header)
+			}
+			assert.Equal(t, tc.want, m.timeoutOf(&web.Context{Req: req}))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackRenderer MessagePack 的 Renderer, 默认没有注册, 要用的话自己注册:
+//
+//	web.RegisterRenderer("application/msgpack", "", web.MsgpackRenderer)
+//
+// 编码用的是 github.com/vmihailenco/msgpack, 字段名优先用 msgpack 标签, 然后是 json 标签
+// time.Time 编码成 timestamp 扩展类型, 实现了 encoding.BinaryMarshaler 的(例如 uuid.UUID)编码成 bin
+// 这个库遇到循环引用会栈溢出, 所以编码之前先检查一遍, 有循环引用的话返回 error
+func MsgpackRenderer(val any) ([]byte, error) {
+	if err := checkMsgpackCycle(reflect.ValueOf(val), make(map[msgpackRef]struct{})); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackRef 当前路径上的指针, map 和切片, 和 encoding/json 一样, 切片要带上长度
+type msgpackRef struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// checkMsgpackCycle 只走编码的时候会走的字段, 没有导出的和标签是 - 的不管
+// 同一个指针出现多次但是不成环(例如两个字段指向同一个结构体)是可以的
+func checkMsgpackCycle(val reflect.Value, path map[msgpackRef]struct{}) error {
+	if !val.IsValid() {
+		return nil
+	}
+	// 自己编码的类型不会往下走
+	if val.CanInterface() {
+		switch val.Interface().(type) {
+		case msgpack.CustomEncoder, msgpack.Marshaler, encoding.BinaryMarshaler, encoding.TextMarshaler:
+			return nil
+		}
+	}
+	switch val.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if val.IsNil() {
+			return nil
+		}
+		ref := msgpackRef{ptr: val.Pointer(), typ: val.Type()}
+		if val.Kind() == reflect.Slice {
+			ref.len = val.Len()
+		}
+		if _, ok := path[ref]; ok {
+			return fmt.Errorf("web: msgpack 不支持循环引用 %s", val.Type())
+		}
+		path[ref] = struct{}{}
+		defer delete(path, ref)
+	}
+
+	switch val.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return checkMsgpackCycle(val.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < val.Len(); i++ {
+			if err := checkMsgpackCycle(val.Index(i), path); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := val.MapRange()
+		for iter.Next() {
+			if err := checkMsgpackCycle(iter.Key(), path); err != nil {
+				return err
+			}
+			if err := checkMsgpackCycle(iter.Value(), path); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			fd := typ.Field(i)
+			tag, ok := fd.Tag.Lookup("msgpack")
+			if !ok {
+				tag = fd.Tag.Get("json")
+			}
+			// 没有导出的组合字段, 里面导出的字段还是会编码
+			if (!fd.IsExported() && !fd.Anonymous) || tag == "-" {
+				continue
+			}
+			if err := checkMsgpackCycle(val.Field(i), path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestMsgpackRenderer(t *testing.T) {
+	type base struct {
+		ID int64 `json:"id"`
+	}
+	type user struct {
+		base
+		Name     string `json:"name"`
+		Age      uint8  `msgpack:"age,omitempty"`
+		Password string `json:"-"`
+		private  string
+	}
+	// 组合了 time.Time, MarshalBinary 被提升上来了, 和 encoding/json 一样整个编码成 time.Time
+	type event struct {
+		time.Time
+		Name string `json:"name"`
+	}
+	type node struct {
+		Name     string  `json:"name"`
+		Next     *node   `json:"next,omitempty"`
+		Parent   *node   `json:"-"`
+		Children []*node `json:"children,omitempty"`
+	}
+
+	now := time.Date(2023, 9, 1, 8, 0, 0, 123, time.UTC)
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	cycle := &node{Name: "a"}
+	cycle.Next = cycle
+	tree := &node{Name: "root"}
+	tree.Children = []*node{{Name: "child", Parent: tree}}
+	shared := &node{Name: "shared"}
+
+	testCases := []struct {
+		name    string
+		val     any
+		want    any
+		wantErr string
+	}{
+		{
+			name: "struct",
+			val:  user{base: base{ID: 1}, Name: "Tom", Password: "123", private: "x"},
+			want: map[string]any{"id": int8(1), "name": "Tom"},
+		},
+		{
+			// 实现了 BinaryMarshaler 的编码成 bin, 不是 16 个整数的数组
+			name: "binary marshaler",
+			val:  map[string]any{"id": id},
+			want: map[string]any{"id": id[:]},
+		},
+		{
+			name: "time",
+			val:  map[string]any{"at": now},
+			want: map[string]any{"at": now.Local()},
+		},
+		{
+			name: "embedded time",
+			val:  event{Time: now, Name: "start"},
+			want: func() any {
+				data, err := now.MarshalBinary()
+				require.NoError(t, err)
+				return data
+			}(),
+		},
+		{
+			// 标签是 - 的字段不编码, 所以不算循环引用
+			name: "parent pointer",
+			val:  tree,
+			want: map[string]any{"name": "root", "children": []any{map[string]any{"name": "child"}}},
+		},
+		{
+			name: "shared pointer",
+			val:  []*node{shared, shared},
+			want: []any{map[string]any{"name": "shared"}, map[string]any{"name": "shared"}},
+		},
+		{
+			name:    "cycle",
+			val:     cycle,
+			wantErr: "循环引用",
+		},
+		{
+			name: "cycle map",
+			val: func() any {
+				m := map[string]any{}
+				m["self"] = m
+				return m
+			}(),
+			wantErr: "循环引用",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := MsgpackRenderer(tc.val)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var got any
+			require.NoError(t, msgpack.Unmarshal(data, &got))
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMsgpackRenderer_Respond(t *testing.T) {
+	// 默认没有注册
+	_, _, ok := rendererOf("application/msgpack")
+	require.False(t, ok)
+
+	RegisterRenderer("application/msgpack", "", MsgpackRenderer)
+	defer func() {
+		renderers.mutex.Lock()
+		defer renderers.mutex.Unlock()
+		delete(renderers.renderers, "application/msgpack")
+		delete(renderers.contentTypes, "application/msgpack")
+		renderers.order = renderers.order[:len(renderers.order)-1]
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/msgpack")
+	recorder := httptest.NewRecorder()
+	ctx := &Context{Req: req, Resp: recorder}
+	require.NoError(t, ctx.Respond(http.StatusOK, map[string]string{"name": "Tom"}))
+	assert.Equal(t, "application/msgpack", recorder.Header().Get("Content-Type"))
+
+	var got map[string]string
+	require.NoError(t, msgpack.Unmarshal(ctx.RespData, &got))
+	assert.Equal(t, map[string]string{"name": "Tom"}, got)
+}
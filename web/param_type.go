@@ -0,0 +1,65 @@
+package web
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// ParamParser 路径参数的类型约束
+// 返回 error 说明这一段路径不满足约束, 路由不会命中这个节点
+// 返回的值就是转换好类型的值, 可以通过 Context.PathTypedValue 拿到
+type ParamParser func(val string) (any, error)
+
+var paramTypes = struct {
+	mutex   sync.RWMutex
+	parsers map[string]ParamParser
+}{
+	parsers: map[string]ParamParser{
+		"int": func(val string) (any, error) {
+			return strconv.ParseInt(val, 10, 64)
+		},
+		"uint": func(val string) (any, error) {
+			return strconv.ParseUint(val, 10, 64)
+		},
+		"float": func(val string) (any, error) {
+			return strconv.ParseFloat(val, 64)
+		},
+		"bool": func(val string) (any, error) {
+			return strconv.ParseBool(val)
+		},
+		"alpha": func(val string) (any, error) {
+			for _, c := range val {
+				if !unicode.IsLetter(c) {
+					return nil, fmt.Errorf("web: %s 不是纯字母", val)
+				}
+			}
+			return val, nil
+		},
+		"uuid": func(val string) (any, error) {
+			return uuid.Parse(val)
+		},
+		"date": func(val string) (any, error) {
+			return time.Parse(time.DateOnly, val)
+		},
+	},
+}
+
+// RegisterParamType 注册路径参数类型, 注册之后可以用 :name<typ> 的形式使用
+// 要在注册路由之前调用, 同名的会覆盖掉
+func RegisterParamType(typ string, parser ParamParser) {
+	paramTypes.mutex.Lock()
+	defer paramTypes.mutex.Unlock()
+	paramTypes.parsers[typ] = parser
+}
+
+func paramParserOf(typ string) (ParamParser, bool) {
+	paramTypes.mutex.RLock()
+	defer paramTypes.mutex.RUnlock()
+	parser, ok := paramTypes.parsers[typ]
+	return parser, ok
+}
@@ -0,0 +1,253 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Renderer 把 val 序列化成响应体
+type Renderer func(val any) ([]byte, error)
+
+// renderers 按照注册的顺序排列, Accept 是 */* 的时候用第一个
+var renderers = struct {
+	mutex sync.RWMutex
+	// media type 和 Content-Type, 例如 text/plain 和 text/plain; charset=utf-8
+	order        []string
+	contentTypes map[string]string
+	renderers    map[string]Renderer
+}{
+	order: []string{"application/json", "application/xml", "text/xml", "application/yaml", "text/plain", "application/x-protobuf"},
+	contentTypes: map[string]string{
+		"application/json":       "application/json",
+		"application/xml":        "application/xml",
+		"text/xml":               "text/xml",
+		"application/yaml":       "application/yaml",
+		"text/plain":             "text/plain; charset=utf-8",
+		"application/x-protobuf": "application/x-protobuf",
+	},
+	renderers: map[string]Renderer{
+		"application/json":       json.Marshal,
+		"application/xml":        xml.Marshal,
+		"text/xml":               xml.Marshal,
+		"application/yaml":       yaml.Marshal,
+		"text/plain":             renderText,
+		"application/x-protobuf": renderProtobuf,
+	},
+}
+
+// RegisterRenderer 注册 media type 对应的 Renderer, 例如 application/cbor, 已经有的会被覆盖
+// contentType 为空的话就用 mediaType 作为响应的 Content-Type
+func RegisterRenderer(mediaType string, contentType string, renderer Renderer) {
+	renderers.mutex.Lock()
+	defer renderers.mutex.Unlock()
+	if _, ok := renderers.renderers[mediaType]; !ok {
+		renderers.order = append(renderers.order, mediaType)
+	}
+	if contentType == "" {
+		contentType = mediaType
+	}
+	renderers.contentTypes[mediaType] = contentType
+	renderers.renderers[mediaType] = renderer
+}
+
+func rendererOf(mediaType string) (Renderer, string, bool) {
+	renderers.mutex.RLock()
+	defer renderers.mutex.RUnlock()
+	renderer, ok := renderers.renderers[mediaType]
+	return renderer, renderers.contentTypes[mediaType], ok
+}
+
+func renderText(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	case error:
+		return []byte(v.Error()), nil
+	}
+	return []byte(fmt.Sprint(val)), nil
+}
+
+func renderProtobuf(val any) ([]byte, error) {
+	msg, ok := val.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("web: %T 不是 proto.Message", val)
+	}
+	return proto.Marshal(msg)
+}
+
+var ErrNotAcceptable = errors.New("web: 没有满足 Accept 的 Renderer")
+
+// Respond 根据 Accept 头部选择 Renderer, 没有 Accept 的时候用 JSON
+// 没有能满足 Accept 的, 响应 406 并且返回 ErrNotAcceptable
+// 序列化失败会直接返回 error, 不会修改响应
+func (c *Context) Respond(status int, val any) error {
+	AddVary(c.Resp.Header(), "Accept")
+	mediaType, ok := negotiate(c.Req.Header.Get("Accept"))
+	if !ok {
+		c.RespStatusCode = http.StatusNotAcceptable
+		c.RespData = []byte("Not Acceptable")
+		return ErrNotAcceptable
+	}
+	return c.render(status, mediaType, val)
+}
+
+// AddVary 已经有了就不再加, 例如同一个请求里面调用了多次 Respond
+// 或者同一个中间件既注册成了全局的, 又注册在了路由上
+func AddVary(header http.Header, name string) {
+	for _, val := range header.Values("Vary") {
+		for _, field := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+func (c *Context) render(status int, mediaType string, val any) error {
+	renderer, contentType, ok := rendererOf(mediaType)
+	if !ok {
+		return fmt.Errorf("web: 没有注册 %s 的 Renderer", mediaType)
+	}
+	data, err := renderer(val)
+	if err != nil {
+		return err
+	}
+	c.RespBytes(status, contentType, data)
+	return nil
+}
+
+func (c *Context) RespXML(status int, val any) error {
+	return c.render(status, "application/xml", val)
+}
+
+func (c *Context) RespYAML(status int, val any) error {
+	return c.render(status, "application/yaml", val)
+}
+
+func (c *Context) RespString(status int, val string) {
+	c.RespBytes(status, "text/plain; charset=utf-8", []byte(val))
+}
+
+// RespBytes 所有的 RespXXX 最终都是调用这个, 只写 RespData 和 RespStatusCode
+// 真正写到响应里面是在 flashResp, 所以 middleware 还可以修改
+func (c *Context) RespBytes(status int, contentType string, data []byte) {
+	if contentType != "" {
+		c.Resp.Header().Set("Content-Type", contentType)
+	}
+	c.RespStatusCode = status
+	c.RespData = data
+}
+
+// Redirect status 只能是 3xx, 一般用 302, 303, 307 或者 308
+func (c *Context) Redirect(status int, location string) error {
+	if status < http.StatusMultipleChoices || status > http.StatusPermanentRedirect {
+		return fmt.Errorf("web: 跳转的状态码 %d 不对", status)
+	}
+	c.Resp.Header().Set("Location", location)
+	c.RespStatusCode = status
+	c.RespData = nil
+	return nil
+}
+
+func (c *Context) NoContent() {
+	c.RespStatusCode = http.StatusNoContent
+	c.RespData = nil
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+	// 越具体越优先, */* 是 0, text/* 是 1, text/plain 是 2
+	specificity int
+}
+
+// negotiate 按照 q 值从高到低找注册了的 Renderer
+// q 值一样的时候更具体的优先, 再一样的就按照 Accept 里面的顺序
+func negotiate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return "application/json", true
+	}
+	ranges := parseAccept(accept)
+	renderers.mutex.RLock()
+	defer renderers.mutex.RUnlock()
+	for _, r := range ranges {
+		if r.q <= 0 {
+			break
+		}
+		for _, mediaType := range renderers.order {
+			if mediaRangeMatch(r.mediaType, mediaType) && !excluded(ranges, mediaType) {
+				return mediaType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// excluded text/xml;q=0 或者 text/*;q=0 这种代表明确不接受
+// 用的是最具体的那个, 例如 text/*;q=0, text/plain 还是接受 text/plain 的
+func excluded(ranges []acceptRange, mediaType string) bool {
+	specificity, q := -1, 0.0
+	for _, r := range ranges {
+		if r.specificity > specificity && mediaRangeMatch(r.mediaType, mediaType) {
+			specificity, q = r.specificity, r.q
+		}
+	}
+	return specificity >= 0 && q <= 0
+}
+
+func parseAccept(accept string) []acceptRange {
+	parts := strings.Split(accept, ",")
+	res := make([]acceptRange, 0, len(parts))
+	for _, part := range parts {
+		mediaType, params, _ := strings.Cut(part, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "" {
+			continue
+		}
+		r := acceptRange{mediaType: mediaType, q: 1, specificity: 2}
+		if mediaType == "*/*" {
+			r.specificity = 0
+		} else if strings.HasSuffix(mediaType, "/*") {
+			r.specificity = 1
+		}
+		for _, param := range strings.Split(params, ";") {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if q, err := strconv.ParseFloat(val, 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		res = append(res, r)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].q != res[j].q {
+			return res[i].q > res[j].q
+		}
+		return res[i].specificity > res[j].specificity
+	})
+	return res
+}
+
+func mediaRangeMatch(mediaRange string, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "*")
+	return ok && strings.HasSuffix(prefix, "/") && strings.HasPrefix(mediaType, prefix)
+}
@@ -0,0 +1,207 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type renderUser struct {
+	Name string `json:"name" xml:"name" yaml:"name"`
+}
+
+func (u renderUser) String() string {
+	return "user " + u.Name
+}
+
+func TestContext_Respond(t *testing.T) {
+	RegisterRenderer("application/x-test", "", func(val any) ([]byte, error) {
+		return []byte("test"), nil
+	})
+
+	testCases := []struct {
+		name            string
+		accept          string
+		val             any
+		wantCode        int
+		wantContentType string
+		wantBody        string
+		wantErr         error
+	}{
+		{
+			name:            "no accept",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"Tom"}`,
+		},
+		{
+			name:            "any",
+			accept:          "*/*",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"Tom"}`,
+		},
+		{
+			name:            "browser",
+			accept:          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "application/xml",
+			wantBody:        `<renderUser><name>Tom</name></renderUser>`,
+		},
+		{
+			name:            "q value",
+			accept:          "application/json;q=0.5, application/yaml",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "application/yaml",
+			wantBody:        "name: Tom\n",
+		},
+		{
+			name:            "type wildcard",
+			accept:          "text/*",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "text/xml",
+			wantBody:        `<renderUser><name>Tom</name></renderUser>`,
+		},
+		{
+			name:            "excluded",
+			accept:          "text/*, text/xml;q=0",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "user Tom",
+		},
+		{
+			name:            "excluded wildcard",
+			accept:          "text/*;q=0, application/*;q=0.5",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"Tom"}`,
+		},
+		{
+			// 更具体的覆盖掉通配符的 q=0
+			name:            "excluded wildcard specific",
+			accept:          "text/*;q=0, text/plain;q=0.5, application/json;q=0.1",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "user Tom",
+		},
+		{
+			name:     "excluded all",
+			accept:   "text/*;q=0, */*;q=0.1, application/*;q=0",
+			val:      renderUser{Name: "Tom"},
+			wantCode: http.StatusNotAcceptable,
+			wantBody: "Not Acceptable",
+			wantErr:  ErrNotAcceptable,
+		},
+		{
+			name:            "custom",
+			accept:          "application/x-test",
+			val:             renderUser{Name: "Tom"},
+			wantCode:        http.StatusCreated,
+			wantContentType: "application/x-test",
+			wantBody:        "test",
+		},
+		{
+			name:            "protobuf",
+			accept:          "application/x-protobuf",
+			val:             wrapperspb.String("Tom"),
+			wantCode:        http.StatusCreated,
+			wantContentType: "application/x-protobuf",
+			wantBody: func() string {
+				data, _ := proto.Marshal(wrapperspb.String("Tom"))
+				return string(data)
+			}(),
+		},
+		{
+			name:     "not acceptable",
+			accept:   "image/png",
+			val:      renderUser{Name: "Tom"},
+			wantCode: http.StatusNotAcceptable,
+			wantBody: "Not Acceptable",
+			wantErr:  ErrNotAcceptable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			server := NewHTTPServer()
+			server.Get("/user", func(ctx *Context) {
+				// 调用多次也只有一个 Vary
+				_ = ctx.Respond(http.StatusCreated, tc.val)
+				err = ctx.Respond(http.StatusCreated, tc.val)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantContentType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, []string{"Accept"}, recorder.Header().Values("Vary"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestContext_RespHelpers(t *testing.T) {
+	server := NewHTTPServer()
+	server.Get("/json", func(ctx *Context) {
+		_ = ctx.RespJSON(http.StatusAccepted, renderUser{Name: "Tom"})
+	})
+	server.Get("/xml", func(ctx *Context) {
+		_ = ctx.RespXML(http.StatusOK, renderUser{Name: "Tom"})
+	})
+	server.Get("/string", func(ctx *Context) {
+		ctx.RespString(http.StatusOK, "hello")
+	})
+	server.Get("/bytes", func(ctx *Context) {
+		ctx.RespBytes(http.StatusOK, "image/png", []byte{1, 2})
+	})
+	server.Get("/redirect", func(ctx *Context) {
+		require.Error(t, ctx.Redirect(http.StatusOK, "/login"))
+		require.NoError(t, ctx.Redirect(http.StatusFound, "/login"))
+	})
+	server.Delete("/user", func(ctx *Context) {
+		ctx.NoContent()
+	})
+
+	testCases := []struct {
+		method          string
+		path            string
+		wantCode        int
+		wantHeader      string
+		wantHeaderValue string
+		wantBody        string
+	}{
+		{http.MethodGet, "/json", http.StatusAccepted, "Content-Type", "application/json", `{"name":"Tom"}`},
+		{http.MethodGet, "/xml", http.StatusOK, "Content-Type", "application/xml", `<renderUser><name>Tom</name></renderUser>`},
+		{http.MethodGet, "/string", http.StatusOK, "Content-Type", "text/plain; charset=utf-8", "hello"},
+		{http.MethodGet, "/bytes", http.StatusOK, "Content-Type", "image/png", "\x01\x02"},
+		{http.MethodGet, "/redirect", http.StatusFound, "Location", "/login", ""},
+		{http.MethodDelete, "/user", http.StatusNoContent, "Content-Type", "", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantHeaderValue, recorder.Header().Get(tc.wantHeader))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
@@ -2,8 +2,11 @@ package web
 
 import (
 	"fmt"
+	"net/http"
 	"regexp"
+	"slices"
 	"strings"
+	"sync/atomic"
 )
 
 // 用来支持对路由树的操作
@@ -14,6 +17,9 @@ type router struct {
 
 	// http method => 路由树节点
 	trees map[string]*node
+
+	// 每注册一次路由就加一, 节点上缓存的中间件链条版本对不上就要重新构造
+	gen uint64
 }
 
 func NewRouter() router {
@@ -28,6 +34,7 @@ func (r *router) addRoute(method string, path string, handleFunc HandleFunc, mdl
 	if path == "" {
 		panic("path 不能为空")
 	}
+	r.gen++
 
 	root, ok := r.trees[method]
 	if !ok {
@@ -45,12 +52,7 @@ func (r *router) addRoute(method string, path string, handleFunc HandleFunc, mdl
 
 	// 根节点特殊处理下
 	if path == "/" {
-		if root.handler != nil {
-			panic("web: 路由冲突, 重复注册[/]")
-		}
-		root.handler = handleFunc
-		root.mdls = mdls
-		root.route = "/"
+		root.register(path, handleFunc, mdls)
 		return
 	}
 
@@ -63,7 +65,7 @@ func (r *router) addRoute(method string, path string, handleFunc HandleFunc, mdl
 
 	// 切割这个 path
 	segs := strings.Split(path[1:], "/")
-	for _, seg := range segs {
+	for i, seg := range segs {
 		if seg == "" {
 			panic("web: 不能有连续的 /")
 		}
@@ -71,101 +73,89 @@ func (r *router) addRoute(method string, path string, handleFunc HandleFunc, mdl
 		// 递归下去, 找准位置
 		// 如果中途有节点不存在, 你就要创建出来
 		child := root.ChildOrCreate(seg)
+		if child.isCatchAll() && i != len(segs)-1 {
+			panic(fmt.Sprintf("web: 非法路由, 带名字的通配符只能出现在最后 [%s]", path))
+		}
 		root = child
 	}
-	if root.handler != nil {
-		panic(fmt.Sprintf("web: 路由冲突[%s]", path))
-	}
-	root.handler = handleFunc
-	root.mdls = mdls
-	root.route = path
+	root.register(path, handleFunc, mdls)
 }
 
 func (r *router) findRoute(method string, path string) (*matchInfo, bool) {
+	mi := &matchInfo{}
+	if !r.match(method, path, mi) {
+		return nil, false
+	}
+	return mi, true
+}
+
+// match 和 findRoute 一样, 只不过结果写到 mi 里面, 这样 mi 可以跟着 Context 复用
+// 整个过程不切割 path, 直接在原来的字符串上面一段段往后找, 不分配内存
+func (r *router) match(method string, path string, mi *matchInfo) bool {
 	// 基本上是不是也是沿着树深度查找下去
 	root, ok := r.trees[method]
 	if !ok {
-		return nil, false
+		return false
 	}
 
 	// 根节点特殊处理
 	if path == "/" {
-		return &matchInfo{node: root, mdls: root.mdls}, true
+		mi.node = root
+		return true
 	}
 
 	// 这里把前置和后置的 / 都去掉
-	segs := strings.Split(strings.Trim(path, "/"), "/")
-	mi := &matchInfo{}
+	path = strings.Trim(path, "/")
 	cur := root
-	for _, seg := range segs {
-		child, ok := cur.childOf(seg)
+	for start := 0; ; {
+		end := strings.IndexByte(path[start:], '/')
+		seg := path[start:]
+		if end >= 0 {
+			seg = path[start : start+end]
+		}
+
+		child, typedVal, ok := cur.childOf(seg)
 		if !ok {
-			if root.typ == nodeTypeAny {
+			// 末尾的通配符可以匹配多段
+			if cur.typ == nodeTypeAny {
 				mi.node = cur
-				return mi, true
+				return true
 			}
 
-			return nil, false
+			return false
+		}
+
+		// 命中了 /*filepath, 剩下的路径全部归它
+		if child.isCatchAll() {
+			mi.addValue(child.paramName, path[start:])
+			cur = child
+			break
 		}
 
 		// 命中了路径参数
 		if child.paramName != "" {
 			mi.addValue(child.paramName, seg)
 		}
+		// 带类型约束的参数, 把 childOf 里面转换好的值存下来
+		if child.typ == nodeTypeTyped {
+			mi.addTypedValue(child.paramName, typedVal)
+		}
 
 		cur = child
+		if end < 0 {
+			break
+		}
+		start += end + 1
 	}
 	// 代表我确实有这个节点
 	// 但是节点是不是用户注册的有 handler 的, 就不一定了
 
-	mi.mdls = r.findMdls(root, segs)
 	mi.node = cur
-	return mi, true
+	return true
 }
 
-//func (r *router) findMdls(root *node, segs []string) []Middleware {
-//
-//	mdls := []Middleware{}
-//
-//	queue := list.New()
-//	queue.PushBack(root)
-//	for _, seg := range segs {
-//		// 一层一层的处理
-//		l := queue.Len()
-//		for l > 0 {
-//			element := queue.Front()
-//			queue.Remove(element)
-//			node := element.Value.(*node)
-//			if node.mdls != nil {
-//				mdls = append(mdls, node.mdls...)
-//			}
-//
-//			// 先从通配符匹配
-//			if node.starChild != nil {
-//				queue.PushBack(node.starChild)
-//			}
-//
-//			// 静态节点找
-//			child, ok := node.children[seg]
-//			if ok {
-//				queue.PushBack(child)
-//			}
-//
-//			l--
-//		}
-//	}
-//
-//	if queue.Len() > 0 {
-//		for element := queue.Front(); element != nil; element = element.Next() {
-//			node := element.Value.(*node)
-//			if node.mdls != nil {
-//				mdls = append(mdls, node.mdls...)
-//			}
-//		}
-//	}
-//	return mdls
-//}
-
+// findMdls 按层收集 segs 这条路径上所有节点的中间件
+// segs 是注册的路由切割出来的, 所以同一个节点的结果是固定的, 可以缓存下来
 func (r *router) findMdls(root *node, segs []string) []Middleware {
 	queue := []*node{root}
 	res := make([]Middleware, 0, 16)
@@ -190,6 +180,47 @@ func (r *router) findMdls(root *node, segs []string) []Middleware {
 	return res
 }
 
+// anyMethods 是 Any 会注册的方法, 只有业务上常用的
+// CONNECT 是给代理用的, TRACE 会把请求原样返回, 都要单独注册
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// allowedMethods 返回 path 上所有注册了 handler 的方法, 用于构造 Allow 头
+// 注册了 GET 就隐含了 HEAD, 有任何一个方法命中就隐含了 OPTIONS
+// 同时返回命中的节点, 多个方法都命中的时候取方法名最小的那个, 保证结果稳定
+func (r *router) allowedMethods(path string) ([]string, *node) {
+	res := make([]string, 0, len(r.trees)+2)
+	var n *node
+	var nMethod string
+	for method := range r.trees {
+		info, ok := r.findRoute(method, path)
+		if ok && info.node.handler != nil {
+			res = append(res, method)
+			if n == nil || method < nMethod {
+				n, nMethod = info.node, method
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	if slices.Contains(res, http.MethodGet) && !slices.Contains(res, http.MethodHead) {
+		res = append(res, http.MethodHead)
+	}
+	if !slices.Contains(res, http.MethodOptions) {
+		res = append(res, http.MethodOptions)
+	}
+	slices.Sort(res)
+	return res, n
+}
+
 type nodeType int
 
 const (
@@ -201,6 +232,8 @@ const (
 	nodeTypeParam
 	// 通配符匹配
 	nodeTypeAny
+	// 带类型约束的路径参数路由, 例如 :id<int>
+	nodeTypeTyped
 )
 
 type node struct {
@@ -227,17 +260,43 @@ type node struct {
 	regChild *node
 	regExpr  *regexp.Regexp
 
+	// 带类型约束的参数路由, 可以有多个, 按照注册顺序匹配
+	typedChildren []*node
+	parser        ParamParser
+
 	// 中间件
 	mdls []Middleware
+
+	// 预先组装好的完整的中间件链条, 第一次命中的时候构造
+	chain atomic.Pointer[routeChain]
+	// 自动应答 OPTIONS 的链条, 只有注册在 OPTIONS 上的中间件
+	options atomic.Pointer[routeChain]
 }
 
-func (n *node) childrenOf(path string) []*node {
-	res := make([]*node, 0, 4)
-	var static *node
-	if n.children != nil {
-		static = n.children[path]
+type routeChain struct {
+	gen uint64
+	fn  HandleFunc
+}
+
+// register 把业务逻辑和中间件挂到节点上
+// handleFunc 为 nil 说明只是注册中间件(Use, Group), 这时候不检测冲突, 也不能覆盖掉已有的 handler
+// 中间件是追加的, 这样先 Use 再 Get, 或者先 Get 再 Use, 都不会丢中间件
+func (n *node) register(path string, handleFunc HandleFunc, mdls []Middleware) {
+	if handleFunc != nil {
+		if n.handler != nil {
+			panic(fmt.Sprintf("web: 路由冲突, 重复注册[%s]", path))
+		}
+		n.handler = handleFunc
 	}
+	n.mdls = append(n.mdls, mdls...)
+	n.route = path
+}
 
+// childrenOf 找出所有能覆盖 path 这一段的子节点, 它们的中间件都要生效
+// path 是注册的路由里面的一段, 通配符和路径参数可以覆盖任意一段
+// 正则和类型约束路由只覆盖和自己一模一样的那一段
+func (n *node) childrenOf(path string) []*node {
+	res := make([]*node, 0, 4)
 	if n.starChild != nil {
 		res = append(res, n.starChild)
 	}
@@ -246,7 +305,17 @@ func (n *node) childrenOf(path string) []*node {
 		res = append(res, n.paramsChild)
 	}
 
-	if static != nil {
+	if n.regChild != nil && n.regChild.path == path {
+		res = append(res, n.regChild)
+	}
+
+	for _, c := range n.typedChildren {
+		if c.path == path {
+			res = append(res, c)
+		}
+	}
+
+	if static := n.children[path]; static != nil {
 		res = append(res, static)
 	}
 
@@ -255,7 +324,9 @@ func (n *node) childrenOf(path string) []*node {
 
 // 返回值是正确的子节点
 func (n *node) ChildOrCreate(path string) *node {
-	if path == "*" {
+	// * 匹配一段, 在末尾的时候匹配剩下的所有段
+	// *filepath 只能在末尾, 并且会把剩下的路径保存到 filepath 里面
+	if path[0] == '*' {
 		if n.paramsChild != nil {
 			panic("web: 非法路由, 已有路径参数路由. 不允许同时注册通配符路由和路径参数路由")
 		}
@@ -264,23 +335,34 @@ func (n *node) ChildOrCreate(path string) *node {
 			panic("web: 非法路由, 已有正则路由. 不允许同时注册通配符路由和正则路由")
 		}
 
+		if len(n.typedChildren) > 0 {
+			panic("web: 非法路由, 已有类型约束路由. 不允许同时注册通配符路由和类型约束路由")
+		}
+
+		paramName := path[1:]
 		if n.starChild == nil {
 			n.starChild = &node{
-				path: path,
-				typ:  nodeTypeAny,
+				path:      path,
+				typ:       nodeTypeAny,
+				paramName: paramName,
 			}
+		} else if n.starChild.paramName != paramName {
+			panic(fmt.Sprintf("web: 路由冲突, 通配符路由冲突, 已有 %s, 新注册 %s", n.starChild.path, path))
 		}
 		return n.starChild
 	}
 
-	// 以 : 开头, 需要进一步解析, 判断是路径参数路由还是正则路由
+	// 以 : 开头, 需要进一步解析, 判断是路径参数路由, 正则路由还是类型约束路由
 	if path[0] == ':' {
-		parseName, expr, isReg := n.parseParam(path)
-		if isReg {
-			return n.childOrCreateReg(path, expr, parseName)
+		paramName, expr, typ := n.parseParam(path)
+		switch typ {
+		case nodeTypeReg:
+			return n.childOrCreateReg(path, expr, paramName)
+		case nodeTypeTyped:
+			return n.childOrCreateTyped(path, expr, paramName)
+		default:
+			return n.childOrCreateParam(path, paramName)
 		}
-
-		return n.childOrCreateParam(path, parseName)
 	}
 
 	if n.children == nil {
@@ -300,14 +382,20 @@ func (n *node) ChildOrCreate(path string) *node {
 	return child
 }
 
+// isCatchAll 是否是 /*filepath 这种带名字的通配符节点
+func (n *node) isCatchAll() bool {
+	return n.typ == nodeTypeAny && n.paramName != ""
+}
+
 /*
 childOf 优先考虑静态匹配, 匹配不上再考虑通配符匹配
 
 	return:
 		*node: 找到的节点
+		any: 类型约束路由转换好的值, 其它节点为 nil
 		bool: 是否命中
 */
-func (n *node) childOf(path string) (*node, bool) {
+func (n *node) childOf(path string) (*node, any, bool) {
 	if n.children == nil {
 		return n.childOfNonStatic(path)
 	}
@@ -316,24 +404,34 @@ func (n *node) childOf(path string) (*node, bool) {
 	if !ok {
 		return n.childOfNonStatic(path)
 	}
-	return child, ok
+	return child, nil, ok
 }
 
-// parseParam 用于解析是不是正则表达式
+// parseParam 用于解析是不是正则表达式或者类型约束
 // 第一个返回值是参数名字
-// 第二个返回值是正则表达式
-// 第三个返回值为 true 则说明是正则路由
-var reg = regexp.MustCompile(`:(\w+)(?:\((\w+)\))?`)
-
-func (n *node) parseParam(path string) (string, string, bool) {
+// 第二个返回值是正则表达式或者类型约束的名字
+// 第三个返回值是节点类型, :id 为参数路由, :id(expr) 为正则路由, :id<int> 为类型约束路由
+var paramNameReg = regexp.MustCompile(`^:(\w+)`)
 
-	ret := reg.FindStringSubmatch(path)[1:]
-
-	if ret[1] != "" {
-		return ret[0], ret[1], true
+func (n *node) parseParam(path string) (string, string, nodeType) {
+	loc := paramNameReg.FindStringSubmatchIndex(path)
+	if loc == nil {
+		panic(fmt.Sprintf("web: 非法路由, 参数名字不对 [%s]", path))
+	}
+	paramName, rest := path[loc[2]:loc[3]], path[loc[1]:]
+	if rest == "" {
+		return paramName, "", nodeTypeParam
 	}
 
-	return ret[0], "", false
+	last := rest[len(rest)-1]
+	switch {
+	// 括号里面是完整的正则表达式, 括号本身可以嵌套, 所以只看头尾
+	case rest[0] == '(' && last == ')' && len(rest) > 2:
+		return paramName, rest[1 : len(rest)-1], nodeTypeReg
+	case rest[0] == '<' && last == '>' && len(rest) > 2:
+		return paramName, rest[1 : len(rest)-1], nodeTypeTyped
+	}
+	panic(fmt.Sprintf("web: 非法路由, 参数格式不对 [%s]", path))
 }
 
 func (n *node) childOrCreateReg(path string, expr string, paramName string) *node {
@@ -343,12 +441,16 @@ func (n *node) childOrCreateReg(path string, expr string, paramName string) *nod
 	if n.paramsChild != nil {
 		panic(fmt.Sprintf("web: 非法路由，已有路径参数路由。不允许同时注册正则路由和参数路由 [%s]", path))
 	}
+	if len(n.typedChildren) > 0 {
+		panic(fmt.Sprintf("web: 非法路由，已有类型约束路由。不允许同时注册正则路由和类型约束路由 [%s]", path))
+	}
 	if n.regChild != nil {
-		if n.regChild.regExpr.String() != expr || n.paramName != paramName {
+		if n.regChild.path != path {
 			panic(fmt.Sprintf("web: 路由冲突，正则路由冲突，已有 %s，新注册 %s", n.regChild.path, path))
 		}
 	} else {
-		regExpr, err := regexp.Compile(expr)
+		// 正则要匹配整段, 不能只匹配一部分
+		regExpr, err := regexp.Compile("^(?:" + expr + ")$")
 		if err != nil {
 			panic(fmt.Errorf("web: 正则表达式错误 %w", err))
 		}
@@ -372,6 +474,10 @@ func (n *node) childOrCreateParam(path string, paramName string) *node {
 		panic(fmt.Sprintf("web: 非法路由，已有通配符路由。不允许同时注册通配符路由和参数路由 [%s]", path))
 	}
 
+	if len(n.typedChildren) > 0 {
+		panic(fmt.Sprintf("web: 非法路由，已有类型约束路由。不允许同时注册类型约束路由和参数路由 [%s]", path))
+	}
+
 	if n.paramsChild != nil {
 		if n.paramsChild.paramName != paramName {
 			panic(fmt.Sprintf("web: 路由冲突，参数路由冲突，已有 %s，新注册 %s", n.paramsChild.path, path))
@@ -387,28 +493,83 @@ func (n *node) childOrCreateParam(path string, paramName string) *node {
 	return n.paramsChild
 }
 
+func (n *node) childOrCreateTyped(path string, typ string, paramName string) *node {
+	if n.starChild != nil {
+		panic(fmt.Sprintf("web: 非法路由，已有通配符路由。不允许同时注册通配符路由和类型约束路由 [%s]", path))
+	}
+	if n.paramsChild != nil {
+		panic(fmt.Sprintf("web: 非法路由，已有路径参数路由。不允许同时注册类型约束路由和参数路由 [%s]", path))
+	}
+	if n.regChild != nil {
+		panic(fmt.Sprintf("web: 非法路由，已有正则路由。不允许同时注册类型约束路由和正则路由 [%s]", path))
+	}
+	parser, ok := paramParserOf(typ)
+	if !ok {
+		panic(fmt.Sprintf("web: 非法路由, 未知的参数类型 %s [%s]", typ, path))
+	}
+
+	for _, c := range n.typedChildren {
+		if c.path == path {
+			return c
+		}
+		if c.path[len(c.paramName)+1:] == path[len(paramName)+1:] {
+			panic(fmt.Sprintf("web: 路由冲突，类型约束路由冲突，已有 %s，新注册 %s", c.path, path))
+		}
+	}
+
+	child := &node{
+		typ:       nodeTypeTyped,
+		path:      path,
+		paramName: paramName,
+		parser:    parser,
+	}
+	n.typedChildren = append(n.typedChildren, child)
+	return child
+}
+
 // childOfNonStatic 从非静态匹配的子节点里面找
-func (n *node) childOfNonStatic(path string) (*node, bool) {
+// 顺序是 正则 > 类型约束 > 路径参数 > 通配符
+// 命中类型约束路由的时候, 顺便返回转换好的值, 不用再转换一次
+func (n *node) childOfNonStatic(path string) (*node, any, bool) {
 
-	if n.regChild != nil && n.regChild.regExpr.Match([]byte(path)) {
-		return n.regChild, true
+	if n.regChild != nil && n.regChild.regExpr.MatchString(path) {
+		return n.regChild, nil, true
+	}
+	for _, c := range n.typedChildren {
+		if val, err := c.parser(path); err == nil {
+			return c, val, true
+		}
 	}
 	if n.paramsChild != nil {
-		return n.paramsChild, true
+		return n.paramsChild, nil, true
 	}
 
-	return n.starChild, n.starChild != nil
+	return n.starChild, nil, n.starChild != nil
 }
 
 type matchInfo struct {
-	node       *node
-	pathParams map[string]string
-	mdls       []Middleware
+	node        *node
+	pathParams  Params
+	typedParams []typedParam
+}
+
+type typedParam struct {
+	key string
+	val any
 }
 
 func (m *matchInfo) addValue(key string, value string) {
-	if m.pathParams == nil {
-		m.pathParams = map[string]string{key: value}
-	}
-	m.pathParams[key] = value
+	m.pathParams = append(m.pathParams, Param{Key: key, Value: value})
+}
+
+func (m *matchInfo) addTypedValue(key string, value any) {
+	m.typedParams = append(m.typedParams, typedParam{key: key, val: value})
+}
+
+// reset 保留切片的容量, 下一次匹配接着用
+func (m *matchInfo) reset() {
+	m.node = nil
+	m.pathParams = m.pathParams[:0]
+	clear(m.typedParams)
+	m.typedParams = m.typedParams[:0]
 }
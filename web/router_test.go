@@ -3,11 +3,17 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRouter_addRoute(t *testing.T) {
@@ -327,8 +333,8 @@ func TestRouter_findRoute(t *testing.T) {
 					path:    ":username",
 					handler: mockHandleFunc,
 				},
-				pathParams: map[string]string{
-					"username": "hexiaowen",
+				pathParams: Params{
+					{Key: "username", Value: "hexiaowen"},
 				},
 			},
 		},
@@ -498,3 +504,317 @@ func (n *node) equal(y *node) (string, bool) {
 
 	return "", true
 }
+
+func TestRouter_findRoute_catchAll(t *testing.T) {
+	var mockHandleFunc HandleFunc = func(ctx *Context) {}
+	r := NewRouter()
+	r.addRoute(http.MethodGet, "/static/*filepath", mockHandleFunc)
+	r.addRoute(http.MethodGet, "/order/*", mockHandleFunc)
+	r.addRoute(http.MethodGet, "/user/*/detail", mockHandleFunc)
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantFound  bool
+		wantRoute  string
+		wantParams Params
+	}{
+		{
+			name:       "catch all one segment",
+			path:       "/static/app.js",
+			wantFound:  true,
+			wantRoute:  "/static/*filepath",
+			wantParams: Params{{Key: "filepath", Value: "app.js"}},
+		},
+		{
+			name:       "catch all nested",
+			path:       "/static/css/theme/app.css",
+			wantFound:  true,
+			wantRoute:  "/static/*filepath",
+			wantParams: Params{{Key: "filepath", Value: "css/theme/app.css"}},
+		},
+		{
+			// 末尾的 * 可以匹配多段, 但是不保存
+			name:      "tail star",
+			path:      "/order/a/b/c",
+			wantFound: true,
+			wantRoute: "/order/*",
+		},
+		{
+			name:      "mid star",
+			path:      "/user/123/detail",
+			wantFound: true,
+			wantRoute: "/user/*/detail",
+		},
+		{
+			// 中间的 * 只匹配一段
+			name: "mid star more segments",
+			path: "/user/123/456/detail",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, found := r.findRoute(http.MethodGet, tc.path)
+			if found {
+				found = info.node.handler != nil
+			}
+			assert.Equal(t, tc.wantFound, found)
+			if !found {
+				return
+			}
+			assert.Equal(t, tc.wantRoute, info.node.route)
+			assert.Equal(t, tc.wantParams, info.pathParams)
+		})
+	}
+
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/static/*", mockHandleFunc)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/files/*filepath/detail", mockHandleFunc)
+	})
+}
+
+func TestRouter_findRoute_constraint(t *testing.T) {
+	var mockHandleFunc HandleFunc = func(ctx *Context) {}
+	r := NewRouter()
+	r.addRoute(http.MethodGet, "/order/:id([0-9]+)", mockHandleFunc)
+	r.addRoute(http.MethodGet, "/file/:name(.*\\.txt)", mockHandleFunc)
+	r.addRoute(http.MethodGet, "/user/:id<int>", mockHandleFunc)
+	r.addRoute(http.MethodGet, "/user/:uid<uuid>", mockHandleFunc)
+	r.addRoute(http.MethodGet, "/report/:day<date>/detail", mockHandleFunc)
+
+	uid := uuid.New()
+	day, err := time.Parse(time.DateOnly, "2023-08-01")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantFound  bool
+		wantRoute  string
+		wantParams Params
+		wantTyped  []typedParam
+	}{
+		{
+			name:       "reg",
+			path:       "/order/123",
+			wantFound:  true,
+			wantRoute:  "/order/:id([0-9]+)",
+			wantParams: Params{{Key: "id", Value: "123"}},
+		},
+		{
+			// 正则要匹配整段
+			name: "reg partial",
+			path: "/order/123abc",
+		},
+		{
+			name:       "reg any",
+			path:       "/file/a.b.txt",
+			wantFound:  true,
+			wantRoute:  "/file/:name(.*\\.txt)",
+			wantParams: Params{{Key: "name", Value: "a.b.txt"}},
+		},
+		{
+			name:       "int",
+			path:       "/user/123",
+			wantFound:  true,
+			wantRoute:  "/user/:id<int>",
+			wantParams: Params{{Key: "id", Value: "123"}},
+			wantTyped:  []typedParam{{key: "id", val: int64(123)}},
+		},
+		{
+			name:       "uuid",
+			path:       "/user/" + uid.String(),
+			wantFound:  true,
+			wantRoute:  "/user/:uid<uuid>",
+			wantParams: Params{{Key: "uid", Value: uid.String()}},
+			wantTyped:  []typedParam{{key: "uid", val: uid}},
+		},
+		{
+			// 类型约束都不满足
+			name: "typed invalid",
+			path: "/user/tom",
+		},
+		{
+			name:       "date",
+			path:       "/report/2023-08-01/detail",
+			wantFound:  true,
+			wantRoute:  "/report/:day<date>/detail",
+			wantParams: Params{{Key: "day", Value: "2023-08-01"}},
+			wantTyped:  []typedParam{{key: "day", val: day}},
+		},
+		{
+			name: "date invalid",
+			path: "/report/2023-13-01/detail",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, found := r.findRoute(http.MethodGet, tc.path)
+			if found {
+				found = info.node.handler != nil
+			}
+			assert.Equal(t, tc.wantFound, found)
+			if !found {
+				return
+			}
+			assert.Equal(t, tc.wantRoute, info.node.route)
+			assert.Equal(t, tc.wantParams, info.pathParams)
+			assert.Equal(t, tc.wantTyped, info.typedParams)
+		})
+	}
+
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/a/:id<unknown>", mockHandleFunc)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/user/:userId<int>", mockHandleFunc)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/b/:id([0-9]+", mockHandleFunc)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/order/:id([a-z]+)", mockHandleFunc)
+	})
+	// 类型约束路由不能和参数路由, 正则路由同时注册
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/user/:name", mockHandleFunc)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/user/:name(\\w+)", mockHandleFunc)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/order/:id<int>", mockHandleFunc)
+	})
+	r.addRoute(http.MethodGet, "/shop/:name", mockHandleFunc)
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/shop/:id<int>", mockHandleFunc)
+	})
+}
+
+func TestPathValueAs(t *testing.T) {
+	RegisterParamType("even", func(val string) (any, error) {
+		i, err := strconv.Atoi(val)
+		if err != nil || i%2 != 0 {
+			return nil, fmt.Errorf("%s 不是偶数", val)
+		}
+		return i, nil
+	})
+
+	server := NewHTTPServer()
+	server.Get("/num/:n<even>", func(ctx *Context) {
+		n, err := PathValueAs[int](ctx, "n")
+		require.NoError(t, err)
+		_, err = PathValueAs[string](ctx, "n")
+		assert.Error(t, err)
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte(strconv.Itoa(n / 2))
+	})
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/num/42", nil))
+	assert.Equal(t, "21", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/num/43", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// BenchmarkMiddlewareChain 对比每个请求都重新组装中间件链条, 和使用节点上缓存的链条
+func BenchmarkMiddlewareChain(b *testing.B) {
+	var nopMdl Middleware = func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+		}
+	}
+	var handler HandleFunc = func(ctx *Context) {}
+	server := NewHTTPServer(ServerWithMiddleware(nopMdl, nopMdl))
+	server.Use(http.MethodGet, "/api", nopMdl)
+	server.Use(http.MethodGet, "/api/*", nopMdl)
+	server.Get("/api/user/home", handler)
+	server.Get("/api/user/:id", handler)
+	info, ok := server.findRoute(http.MethodGet, "/api/user/home")
+	require.True(b, ok)
+	ctx := &Context{}
+
+	b.Run("rebuild", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			segs := strings.Split(strings.Trim("/api/user/home", "/"), "/")
+			root := handler
+			mdls := server.findMdls(server.trees[http.MethodGet], segs)
+			for j := len(mdls) - 1; j >= 0; j-- {
+				root = mdls[j](root)
+			}
+			for j := len(server.mdls) - 1; j >= 0; j-- {
+				root = server.mdls[j](root)
+			}
+			root(ctx)
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			server.handlerOnce.Do(server.buildHandler)
+			server.chainOf(http.MethodGet, info.node)(ctx)
+		}
+	})
+}
+
+// BenchmarkHTTPServer_ServeHTTP 完整的一次请求
+func BenchmarkHTTPServer_ServeHTTP(b *testing.B) {
+	var nopMdl Middleware = func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+		}
+	}
+	var handler HandleFunc = func(ctx *Context) {}
+	server := NewHTTPServer(ServerWithMiddleware(nopMdl, nopMdl))
+	server.Use(http.MethodGet, "/api", nopMdl)
+	server.Use(http.MethodGet, "/api/*", nopMdl)
+	server.Get("/api/user/home", handler)
+	server.Get("/api/user/:id", handler)
+
+	testCases := []struct {
+		name string
+		path string
+	}{
+		{
+			name: "static",
+			path: "/api/user/home",
+		},
+		{
+			name: "param",
+			path: "/api/user/123",
+		},
+	}
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			writer := nopResponseWriter{header: http.Header{}}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				server.ServeHTTP(writer, req)
+			}
+		})
+	}
+}
+
+// nopResponseWriter 不记录任何东西, 避免干扰 benchmark 的内存分配
+type nopResponseWriter struct {
+	header http.Header
+}
+
+func (n nopResponseWriter) Header() http.Header {
+	return n.header
+}
+
+func (n nopResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (n nopResponseWriter) WriteHeader(statusCode int) {}
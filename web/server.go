@@ -1,9 +1,15 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // 确保一定实现了 Server 接口
@@ -17,6 +23,9 @@ type Server interface {
 
 	Start(addr string) error
 
+	// Shutdown 优雅退出
+	Shutdown(ctx context.Context) error
+
 	// addRoute 增加路由注册的功能
 	// method 是 HTTP 方法
 	// path 是路径
@@ -29,13 +38,12 @@ type Server interface {
 
 }
 
-//type HTTPSServer struct {
-//	HTTPServer
-//}
-
 // TODO 采用的是 options 模式, 也是无侵入式的, 牛逼, 必须得吃透
 type HTTPServerOption func(server *HTTPServer)
 
+// Hook 生命周期回调, 比如说启动之后往注册中心注册自己, 关闭的时候注销自己
+type Hook func(ctx context.Context) error
+
 type HTTPServer struct {
 	router
 	mdls []Middleware
@@ -43,6 +51,27 @@ type HTTPServer struct {
 	log func(msg string, args ...any)
 
 	tplEngine TemplateEngine
+
+	// 所有 listener 共用一个 http.Server, 这样 Shutdown 一次就全部关掉了
+	server *http.Server
+
+	onStart    []Hook
+	onShutdown []Hook
+
+	// HTTP 跳转 HTTPS 的监听地址, 为空就不跳转
+	redirectAddr string
+	// 保护 redirectServer, ServeTLS 和 Shutdown 一般不在一个 goroutine 里面
+	mutex          sync.Mutex
+	redirectServer *http.Server
+
+	// 全局的请求体大小限制, 0 代表不限制, 路由上可以用 MaxBodySize 覆盖
+	maxBodySize int64
+
+	// 全局中间件加上 serve 组装好的链条
+	handlerOnce sync.Once
+	handler     HandleFunc
+
+	ctxPool sync.Pool
 }
 
 // 另外一种方案, 我不喜欢, 缺乏扩展性
@@ -61,6 +90,12 @@ func NewHTTPServer(opts ...HTTPServerOption) *HTTPServer {
 			fmt.Printf(msg, args...)
 		},
 	}
+	res.server = &http.Server{
+		Handler: res,
+	}
+	res.ctxPool.New = func() any {
+		return &Context{}
+	}
 	for _, opt := range opts {
 		opt(res)
 	}
@@ -79,16 +114,71 @@ func ServerWithMiddleware(mdls ...Middleware) HTTPServerOption {
 	}
 }
 
+// ServerWithReadTimeout 读取整个请求(包括请求体)的超时时间
+func ServerWithReadTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.server.ReadTimeout = timeout
+	}
+}
+
+// ServerWithReadHeaderTimeout 读取请求头的超时时间, 防止慢速攻击
+func ServerWithReadHeaderTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.server.ReadHeaderTimeout = timeout
+	}
+}
+
+// ServerWithWriteTimeout 从读完请求头到写完响应的超时时间
+func ServerWithWriteTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.server.WriteTimeout = timeout
+	}
+}
+
+// ServerWithIdleTimeout keep-alive 连接的空闲超时时间
+func ServerWithIdleTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.server.IdleTimeout = timeout
+	}
+}
+
+// ServerWithMaxHeaderBytes 请求头的最大字节数
+func ServerWithMaxHeaderBytes(n int) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.server.MaxHeaderBytes = n
+	}
+}
+
+// ServerWithMaxBodySize 全局的请求体大小限制, 超过了返回 413
+// 单个路由可以用 MaxBodySize 中间件覆盖
+func ServerWithMaxBodySize(n int64) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.maxBodySize = n
+	}
+}
+
 // ServeHTTP 处理请求的入口
 func (h *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	// 你的框架代码在这里
-	ctx := &Context{
-		Req:       request,
-		Resp:      writer,
-		tplEngine: h.tplEngine,
-	}
+	ctx := h.ctxPool.Get().(*Context)
+	ctx.Req = request
+	ctx.Resp = writer
+	ctx.tplEngine = h.tplEngine
+	h.serveHTTP(ctx)
+	ctx.reset()
+	h.ctxPool.Put(ctx)
+}
+
+func (h *HTTPServer) serveHTTP(ctx *Context) {
 	//h.serve(ctx)
 
+	// 链条只在第一次请求的时候构造, 之后直接调用
+	h.handlerOnce.Do(h.buildHandler)
+	h.handler(ctx)
+}
+
+// buildHandler 构造全局中间件的链条
+func (h *HTTPServer) buildHandler() {
 	// 这里构造链条非常经典
 
 	// 最后一个是这个
@@ -112,14 +202,31 @@ func (h *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request
 			h.flashResp(ctx)
 		}
 	}
-	root = m(root)
-	root(ctx)
+	h.handler = m(root)
 }
 
 func (h *HTTPServer) flashResp(ctx *Context) {
+	// 已经流式输出过了, 响应头和响应体都写出去了
+	if ctx.committed {
+		return
+	}
+	// HEAD 请求只要响应头, 不要响应体
+	if ctx.Req.Method == http.MethodHead {
+		header := ctx.Resp.Header()
+		if header.Get("Content-Length") == "" {
+			header.Set("Content-Length", strconv.Itoa(len(ctx.RespData)))
+		}
+		if ctx.RespStatusCode != 0 {
+			ctx.Resp.WriteHeader(ctx.RespStatusCode)
+		}
+		return
+	}
 	if ctx.RespStatusCode != 0 {
 		ctx.Resp.WriteHeader(ctx.RespStatusCode)
 	}
+	if len(ctx.RespData) == 0 {
+		return
+	}
 	n, err := ctx.Resp.Write(ctx.RespData)
 	if err != nil || n != len(ctx.RespData) {
 		h.log("写入响应数据失败 %v", err)
@@ -130,28 +237,105 @@ func (h *HTTPServer) serve(ctx *Context) {
 	// before route
 
 	// 接下来查找路由并且执行命中的业务逻辑
-	info, ok := h.findRoute(ctx.Req.Method, ctx.Req.URL.Path)
+	method := ctx.Req.Method
+	info := &ctx.mi
+	ok := h.match(method, ctx.Req.URL.Path, info)
+	if (!ok || info.node.handler == nil) && method == http.MethodHead {
+		// HEAD 没有注册的话, 就用 GET 的, 响应体在 flashResp 里面丢掉
+		method = http.MethodGet
+		info.reset()
+		ok = h.match(method, ctx.Req.URL.Path, info)
+	}
 	// after route
 	if !ok || info.node.handler == nil {
-		// 路由没有命中
-		ctx.RespStatusCode = 404
-		ctx.RespData = []byte("Not Found")
+		// 路由没有命中, 看看是不是别的方法注册了这个路径
+		allow, n := h.allowedMethods(ctx.Req.URL.Path)
+		if len(allow) == 0 {
+			ctx.RespStatusCode = http.StatusNotFound
+			ctx.RespData = []byte("Not Found")
+			return
+		}
+		ctx.Resp.Header().Set("Allow", strings.Join(allow, ", "))
+		if ctx.Req.Method == http.MethodOptions {
+			h.autoOptions(ctx, n)
+			return
+		}
+		ctx.RespStatusCode = http.StatusMethodNotAllowed
+		ctx.RespData = []byte("Method Not Allowed")
+		return
+	}
+	ctx.PathParams = info.pathParams
+	// 路由级别的中间件也要用, 例如 authz 按照路由找规则
+	ctx.MatchedRoute = info.node.route
+	// 全局的限制先包上去, 路由上的 MaxBodySize 会覆盖它
+	// Content-Length 等到执行 handler 之前按照最终生效的限制检查
+	if h.maxBodySize > 0 {
+		ctx.wrapBody(h.maxBodySize)
+	}
+	h.chainOf(method, info.node)(ctx)
+}
+
+// autoOptions 自动应答 OPTIONS, n 是别的方法命中的节点
+// 没有注册 OPTIONS 的 handler, 但是注册在 OPTIONS 上的中间件还是要执行, 例如 CORS 要处理预检请求
+// 只会执行明确注册在 OPTIONS 上的中间件, 分组和别的方法上的中间件(例如鉴权)都不会执行
+// 中间件按照 n 的路由去 OPTIONS 的树上找, 和 chainOf 一样缓存在节点上
+func (h *HTTPServer) autoOptions(ctx *Context, n *node) {
+	ctx.MatchedRoute = n.route
+	if c := n.options.Load(); c != nil && c.gen == h.gen {
+		c.fn(ctx)
 		return
 	}
+
+	var root HandleFunc = func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusNoContent
+	}
+	if tree, ok := h.trees[http.MethodOptions]; ok {
+		mdls := h.findMdls(tree, routeSegs(n.route))
+		for i := len(mdls) - 1; i >= 0; i-- {
+			root = mdls[i](root)
+		}
+	}
+	n.options.Store(&routeChain{gen: h.gen, fn: root})
+	root(ctx)
+}
+
+// chainOf 返回节点上缓存的路由级别的中间件链条
+// 注册了新的路由之后, 缓存会失效, 下一次命中的时候重新构造
+func (h *HTTPServer) chainOf(method string, n *node) HandleFunc {
+	if c := n.chain.Load(); c != nil && c.gen == h.gen {
+		return c.fn
+	}
+
 	var root HandleFunc = func(ctx *Context) {
-		ctx.PathParams = info.pathParams
-		ctx.MatchedRoute = info.node.route
+		if ctx.bodyLimit > 0 && ctx.Req.ContentLength > ctx.bodyLimit {
+			ctx.respBodyTooLarge()
+			return
+		}
 		// before execute
-		info.node.handler(ctx)
+		n.handler(ctx)
 		// after execute
+
+		// 读请求体的时候超过了大小限制, 不管 handler 怎么处理的, 统一返回 413
+		if ctx.bodyTooLarge && !ctx.committed {
+			ctx.respBodyTooLarge()
+		}
 	}
 
 	// 构建路由级别的中间件
-	mdls := info.mdls
+	mdls := h.findMdls(h.trees[method], routeSegs(n.route))
 	for i := len(mdls) - 1; i >= 0; i-- {
 		root = mdls[i](root)
 	}
-	root(ctx)
+	n.chain.Store(&routeChain{gen: h.gen, fn: root})
+	return root
+}
+
+// routeSegs 把注册的路由切成段, 用来在树上收集中间件
+func routeSegs(route string) []string {
+	if route == "/" {
+		return nil
+	}
+	return strings.Split(route[1:], "/")
 }
 
 func (h *HTTPServer) Use(method string, path string, mdls ...Middleware) {
@@ -174,28 +358,115 @@ func (h *HTTPServer) Post(path string, handleFunc HandleFunc) {
 	h.addRoute(http.MethodPost, path, handleFunc)
 }
 
+func (h *HTTPServer) Put(path string, handleFunc HandleFunc) {
+	h.addRoute(http.MethodPut, path, handleFunc)
+}
+
+func (h *HTTPServer) Delete(path string, handleFunc HandleFunc) {
+	h.addRoute(http.MethodDelete, path, handleFunc)
+}
+
+func (h *HTTPServer) Patch(path string, handleFunc HandleFunc) {
+	h.addRoute(http.MethodPatch, path, handleFunc)
+}
+
+// Head 一般不需要注册, 没有注册的时候会用 GET 的 handler
+func (h *HTTPServer) Head(path string, handleFunc HandleFunc) {
+	h.addRoute(http.MethodHead, path, handleFunc)
+}
+
 func (h *HTTPServer) Options(path string, handleFunc HandleFunc) {
 	// 委托给 addRoute 去执行, 这种用法很常见
 	h.addRoute(http.MethodOptions, path, handleFunc)
 }
 
+// Any 在常用的 HTTP 方法上注册同一个 handler, 不包括 CONNECT 和 TRACE
+func (h *HTTPServer) Any(path string, handleFunc HandleFunc) {
+	for _, method := range anyMethods {
+		h.addRoute(method, path, handleFunc)
+	}
+}
+
 //func (h *HTTPServer) addRoute1(method string, path string, handlesFunc ...HandleFunc) {
 //	panic("implement me")
 //}
 
-func (h *HTTPServer) Start(addr string) error {
-	// 也可以这种方式创建 Server
-	//http.Server{}
+// OnStart 注册启动回调, 在端口监听成功之后, 开始处理请求之前执行
+// 任何一个回调返回 error, 都不会启动
+func (h *HTTPServer) OnStart(hooks ...Hook) {
+	h.onStart = append(h.onStart, hooks...)
+}
 
+// OnShutdown 注册关闭回调, 在 Shutdown 等待已有请求处理完之后, 按照注册顺序执行
+// 比如说从注册中心注销, 刷新 session 存储
+func (h *HTTPServer) OnShutdown(hooks ...Hook) {
+	h.onShutdown = append(h.onShutdown, hooks...)
+}
+
+// Start 监听 addr, 要监听多个地址用 Serve
+func (h *HTTPServer) Start(addr string) error {
 	listen, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
+	return h.Serve(listen)
+}
+
+// Serve 在多个 listener 上同时处理请求, 会一直阻塞
+// 调用 Shutdown 之后返回 http.ErrServerClosed, 但是这个时候已有的请求可能还在处理, 要等 Shutdown 返回
+// 任何一个 listener 出错, 都会把所有的 listener 关掉
+func (h *HTTPServer) Serve(listeners ...net.Listener) error {
+	return h.serveAll(listeners, h.server.Serve)
+}
+
+// serveAll 在每一个 listener 上面调用 serve
+func (h *HTTPServer) serveAll(listeners []net.Listener, serve func(l net.Listener) error) error {
+	if len(listeners) == 0 {
+		return errors.New("web: 至少需要一个 listener")
+	}
+
 	// 在这里, 可以让用户注册所谓的 after start 回调
 	// 比如说往你的 admin 注册一下自己这个实例
 	// 在这里执行一些你业务所需的前置条件
+	for _, hook := range h.onStart {
+		if err := hook(context.Background()); err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return err
+		}
+	}
 
-	return http.Serve(listen, h)
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errCh <- serve(l)
+		}(l)
+	}
+
+	err := <-errCh
+	if !errors.Is(err, http.ErrServerClosed) {
+		_ = h.server.Close()
+	}
+	for i := 1; i < len(listeners); i++ {
+		<-errCh
+	}
+	return err
+}
+
+// Shutdown 优雅退出
+// 先停止接收新请求, 等已有的请求处理完(或者 ctx 超时), 再执行 OnShutdown 回调
+func (h *HTTPServer) Shutdown(ctx context.Context) error {
+	err := h.server.Shutdown(ctx)
+	if rs := h.getRedirectServer(); rs != nil {
+		err = errors.Join(err, rs.Shutdown(ctx))
+	}
+	for _, hook := range h.onShutdown {
+		if hookErr := hook(ctx); hookErr != nil {
+			err = errors.Join(err, hookErr)
+		}
+	}
+	return err
 }
 
 //func (h *HTTPServer) Start1(addr string) error {
@@ -1,9 +1,18 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // server 就是 handler,  http 和 web 框架的结合点
@@ -43,3 +52,300 @@ func TestHTTPServer_ServeHTTP(t *testing.T) {
 	}
 	server.ServeHTTP(nil, &http.Request{})
 }
+
+func TestHTTPServer_Methods(t *testing.T) {
+	server := NewHTTPServer()
+	handlerOf := func(data string) HandleFunc {
+		return func(ctx *Context) {
+			ctx.RespStatusCode = http.StatusOK
+			ctx.RespData = []byte(data)
+		}
+	}
+	server.Get("/user", handlerOf("get user"))
+	server.Post("/user", handlerOf("post user"))
+	server.Put("/user/:id", handlerOf("put user"))
+	server.Patch("/user/:id", handlerOf("patch user"))
+	server.Delete("/user/:id", handlerOf("delete user"))
+	server.Head("/order", handlerOf("head order"))
+	server.Options("/order", handlerOf("options order"))
+	server.Any("/any", handlerOf("any"))
+
+	testCases := []struct {
+		name      string
+		method    string
+		path      string
+		wantCode  int
+		wantData  string
+		wantAllow string
+	}{
+		{
+			name:     "get",
+			method:   http.MethodGet,
+			path:     "/user",
+			wantCode: http.StatusOK,
+			wantData: "get user",
+		},
+		{
+			name:     "put",
+			method:   http.MethodPut,
+			path:     "/user/12",
+			wantCode: http.StatusOK,
+			wantData: "put user",
+		},
+		{
+			name:     "patch",
+			method:   http.MethodPatch,
+			path:     "/user/12",
+			wantCode: http.StatusOK,
+			wantData: "patch user",
+		},
+		{
+			name:     "delete",
+			method:   http.MethodDelete,
+			path:     "/user/12",
+			wantCode: http.StatusOK,
+			wantData: "delete user",
+		},
+		{
+			// HEAD 回退到 GET, 但是没有响应体
+			name:     "head fallback",
+			method:   http.MethodHead,
+			path:     "/user",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "method not allowed",
+			method:    http.MethodDelete,
+			path:      "/user",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantData:  "Method Not Allowed",
+			wantAllow: "GET, HEAD, OPTIONS, POST",
+		},
+		{
+			name:      "auto options",
+			method:    http.MethodOptions,
+			path:      "/user/12",
+			wantCode:  http.StatusNoContent,
+			wantAllow: "DELETE, OPTIONS, PATCH, PUT",
+		},
+		{
+			// 用户自己注册了 OPTIONS
+			name:     "registered options",
+			method:   http.MethodOptions,
+			path:     "/order",
+			wantCode: http.StatusOK,
+			wantData: "options order",
+		},
+		{
+			name:     "any",
+			method:   http.MethodPatch,
+			path:     "/any",
+			wantCode: http.StatusOK,
+			wantData: "any",
+		},
+		{
+			name:      "any without trace",
+			method:    http.MethodTrace,
+			path:      "/any",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantData:  "Method Not Allowed",
+			wantAllow: "DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT",
+		},
+		{
+			name:     "not found",
+			method:   http.MethodGet,
+			path:     "/not/found",
+			wantCode: http.StatusNotFound,
+			wantData: "Not Found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantData, recorder.Body.String())
+			assert.Equal(t, tc.wantAllow, recorder.Header().Get("Allow"))
+		})
+	}
+}
+
+func TestHTTPServer_Shutdown(t *testing.T) {
+	var hooks []string
+	server := NewHTTPServer()
+	server.OnStart(func(ctx context.Context) error {
+		hooks = append(hooks, "start")
+		return nil
+	})
+	server.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "deregister")
+		return nil
+	}, func(ctx context.Context) error {
+		hooks = append(hooks, "flush")
+		return nil
+	})
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	server.Get("/slow", func(ctx *Context) {
+		close(entered)
+		<-release
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte("done")
+	})
+	server.Get("/fast", func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte("fast")
+	})
+
+	// 同时监听两个地址
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(l1, l2)
+	}()
+
+	resp, err := http.Get("http://" + l2.Addr().String() + "/fast")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "fast", string(body))
+
+	type result struct {
+		body string
+		err  error
+	}
+	slowRes := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + l1.Addr().String() + "/slow")
+		if err != nil {
+			slowRes <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slowRes <- result{body: string(body), err: err}
+	}()
+	<-entered
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- server.Shutdown(context.Background())
+	}()
+
+	// 已经在处理的请求没有结束之前, Shutdown 不会返回
+	assert.ErrorIs(t, <-serveErr, http.ErrServerClosed)
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown 没有等请求处理完")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	res := <-slowRes
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	require.NoError(t, <-shutdownErr)
+	assert.Equal(t, []string{"start", "deregister", "flush"}, hooks)
+
+	// 已经关闭了, 不再接收新的请求
+	_, err = http.Get("http://" + l2.Addr().String() + "/fast")
+	assert.Error(t, err)
+}
+
+func TestHTTPServer_ShutdownTimeout(t *testing.T) {
+	server := NewHTTPServer()
+	release := make(chan struct{})
+	defer close(release)
+	entered := make(chan struct{})
+	server.Get("/slow", func(ctx *Context) {
+		close(entered)
+		<-release
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(l)
+	}()
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String() + "/slow")
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, server.Shutdown(ctx), context.DeadlineExceeded)
+}
+
+func TestHTTPServer_OnStartError(t *testing.T) {
+	server := NewHTTPServer()
+	wantErr := errors.New("注册失败")
+	server.OnStart(func(ctx context.Context) error {
+		return wantErr
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.Equal(t, wantErr, server.Serve(l))
+	// listener 已经被关掉了
+	_, err = l.Accept()
+	assert.Error(t, err)
+}
+
+func TestHTTPServer_ContextPool(t *testing.T) {
+	server := NewHTTPServer()
+	copied := make(chan *Context, 1)
+	server.Get("/user/:id", func(ctx *Context) {
+		// 上一个请求的数据不能留下来
+		assert.Nil(t, ctx.UserValues)
+		assert.Equal(t, 0, ctx.RespStatusCode)
+		assert.Nil(t, ctx.RespData)
+		assert.Len(t, ctx.PathParams, 1)
+
+		ctx.UserValues = map[string]any{"user": ctx.PathParams[0].Value}
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte("ok")
+		if ctx.PathParams[0].Value == "async" {
+			copied <- ctx.Copy()
+		}
+	})
+
+	for _, id := range []string{"1", "async", "2"} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/"+id, nil))
+		assert.Equal(t, "ok", recorder.Body.String())
+	}
+
+	// 请求结束之后, 复制出来的 Context 还是原来的数据
+	cp := <-copied
+	id, err := cp.PathValue("id")
+	require.NoError(t, err)
+	assert.Equal(t, "async", id)
+	assert.Equal(t, "async", cp.UserValues["user"])
+	assert.Equal(t, "/user/:id", cp.MatchedRoute)
+}
+
+// 路由级别的中间件执行的时候, 已经知道命中的是哪个路由了
+func TestHTTPServer_MatchedRouteInMiddleware(t *testing.T) {
+	server := NewHTTPServer()
+	var routes []string
+	server.Get("/user/:id", func(ctx *Context) {
+		routes = append(routes, "handler "+ctx.MatchedRoute)
+	})
+	server.Use(http.MethodGet, "/user", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			routes = append(routes, "middleware "+ctx.MatchedRoute)
+			next(ctx)
+		}
+	})
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	assert.Equal(t, []string{"middleware /user/:id", "handler /user/:id"}, routes)
+}
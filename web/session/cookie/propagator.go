@@ -1,6 +1,12 @@
 package cookie
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Moty1999/web/web/session"
+)
 
 type Propagator struct {
 	cookieName   string
@@ -9,14 +15,18 @@ type Propagator struct {
 
 type Option func(p *Propagator)
 
-func NewPropagator() *Propagator {
+func NewPropagator(opts ...Option) *Propagator {
 
-	return &Propagator{
+	res := &Propagator{
 		cookieName: "sessid",
 		cookieOption: func(cookie *http.Cookie) {
 
 		},
 	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
 }
 
 func WithCookieName(name string) Option {
@@ -25,6 +35,17 @@ func WithCookieName(name string) Option {
 	}
 }
 
+// WithCookieOption 设置 cookie 的其它属性, 例如 HttpOnly, Secure, Path
+func WithCookieOption(fn func(cookie *http.Cookie)) Option {
+	return func(p *Propagator) {
+		p.cookieOption = fn
+	}
+}
+
+func (p *Propagator) CookieName() string {
+	return p.cookieName
+}
+
 func (p *Propagator) Inject(id string, writer http.ResponseWriter) error {
 	c := &http.Cookie{
 		Name:  p.cookieName,
@@ -37,6 +58,9 @@ func (p *Propagator) Inject(id string, writer http.ResponseWriter) error {
 
 func (p *Propagator) Extract(req *http.Request) (string, error) {
 	c, err := req.Cookie(p.cookieName)
+	if errors.Is(err, http.ErrNoCookie) {
+		return "", fmt.Errorf("%w: %w", session.ErrSessionNotFound, err)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -46,9 +70,11 @@ func (p *Propagator) Extract(req *http.Request) (string, error) {
 
 func (p *Propagator) Remove(writer http.ResponseWriter) error {
 	c := &http.Cookie{
-		Name:   p.cookieName,
-		MaxAge: -1,
+		Name: p.cookieName,
 	}
+	// Path 和 Domain 要和设置的时候一样, 不然删不掉
+	p.cookieOption(c)
+	c.MaxAge = -1
 	http.SetCookie(writer, c)
 	return nil
 }
@@ -0,0 +1,25 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Moty1999/web/web/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropagator_Extract(t *testing.T) {
+	p := NewPropagator()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err := p.Extract(req)
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+	assert.ErrorIs(t, err, http.ErrNoCookie)
+
+	req.AddCookie(&http.Cookie{Name: "sessid", Value: "sess-1"})
+	id, err := p.Extract(req)
+	require.NoError(t, err)
+	assert.Equal(t, "sess-1", id)
+}
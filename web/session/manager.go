@@ -1,6 +1,10 @@
 package session
 
 import (
+	"net/http"
+	"slices"
+	"strings"
+
 	"github.com/Moty1999/web/web"
 	"github.com/google/uuid"
 )
@@ -30,6 +34,7 @@ func (m *Manager) GetSession(ctx *web.Context) (Session, error) {
 		return nil, err
 	}
 
+	m.bind(ctx, sess)
 	ctx.UserValues[m.CtxSessKey] = sess
 	return sess, nil
 }
@@ -42,6 +47,18 @@ func (m *Manager) InitSession(ctx *web.Context) (Session, error) {
 		return nil, err
 	}
 
+	// 同一个请求后面再 GetSession 拿到的是新的
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+	ctx.UserValues[m.CtxSessKey] = sess
+
+	// 数据保存在客户端的话, 注入的是编码之后的整个 Session, 而不是 id
+	if cs, ok := sess.(ClientSession); ok {
+		m.bind(ctx, cs)
+		return sess, cs.Save(ctx.Req.Context())
+	}
+
 	// 注入 HTTP 响应里面
 	err = m.Inject(id, ctx.Resp)
 	return sess, err
@@ -69,5 +86,38 @@ func (m *Manager) RefreshSession(ctx *web.Context) error {
 		return err
 	}
 
+	// 过期时间在客户端的数据里面, 只能重新写一遍
+	if cs, ok := sess.(ClientSession); ok {
+		return cs.Save(ctx.Req.Context())
+	}
 	return m.Refresh(ctx.Req.Context(), sess.ID())
 }
+
+// bind 让数据保存在客户端的 Session 修改之后可以写回响应
+func (m *Manager) bind(ctx *web.Context, sess Session) {
+	cs, ok := sess.(ClientSession)
+	if !ok {
+		return
+	}
+	// 同一个请求里面可能修改好几次, 只保留最后一次写的 Set-Cookie
+	cp, isCookie := m.Propagator.(CookiePropagator)
+	cs.Bind(func(val string) error {
+		if isCookie {
+			removeSetCookie(ctx.Resp.Header(), cp.CookieName())
+		}
+		return m.Inject(val, ctx.Resp)
+	})
+}
+
+// removeSetCookie 去掉名字是 name 的 Set-Cookie, 别的 cookie 不动
+func removeSetCookie(header http.Header, name string) {
+	prefix := name + "="
+	cookies := slices.DeleteFunc(header.Values("Set-Cookie"), func(val string) bool {
+		return strings.HasPrefix(strings.TrimSpace(val), prefix)
+	})
+	if len(cookies) == 0 {
+		header.Del("Set-Cookie")
+		return
+	}
+	header["Set-Cookie"] = cookies
+}
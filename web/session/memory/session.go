@@ -2,7 +2,6 @@ package memory
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/Moty1999/web/web/session"
 	"github.com/patrickmn/go-cache"
@@ -12,8 +11,8 @@ import (
 
 var (
 	// sentinel error. 预定义错误
-	ErrKeyNotFound     = errors.New("session: 找不到 key")
-	ErrSessionNotFound = errors.New("session: 找不到 session")
+	ErrKeyNotFound     = session.ErrKeyNotFound
+	ErrSessionNotFound = session.ErrSessionNotFound
 )
 
 type Store struct {
@@ -44,7 +43,7 @@ func (s *Store) Refresh(ctx context.Context, id string) error {
 	defer s.mutex.Unlock()
 	val, ok := s.sessions.Get(id)
 	if !ok {
-		return fmt.Errorf("session: 该 id 对应的 session 不存在 %s", id)
+		return fmt.Errorf("%w, id %s", ErrSessionNotFound, id)
 	}
 	s.sessions.Set(id, val, s.expiration)
 	return nil
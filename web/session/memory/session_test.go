@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_NotFound(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(time.Minute)
+
+	_, err := store.Get(ctx, "none")
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+	assert.ErrorIs(t, store.Refresh(ctx, "none"), session.ErrSessionNotFound)
+
+	sess, err := store.Generate(ctx, "sess-1")
+	require.NoError(t, err)
+	_, err = sess.Get(ctx, "none")
+	assert.ErrorIs(t, err, session.ErrKeyNotFound)
+
+	require.NoError(t, store.Remove(ctx, "sess-1"))
+	_, err = store.Get(ctx, "sess-1")
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+}
@@ -10,7 +10,7 @@ import (
 )
 
 var (
-	errSessionNotFound = errors.New("session: id 对应的 session 不存在")
+	errSessionNotFound = fmt.Errorf("%w, id 对应的 session 不存在", session.ErrSessionNotFound)
 )
 
 type Store struct {
@@ -110,12 +110,16 @@ type Session struct {
 func (s *Session) Get(ctx context.Context, key string) (any, error) {
 
 	val, err := s.client.HGet(ctx, s.key, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w, key %s", session.ErrKeyNotFound, key)
+	}
 	return val, err
 }
 
 func (s *Session) Set(ctx context.Context, key string, val any) error {
+	// lua 里面 0 也是 true, 要和 1 比
 	const lua = `
-	if redis.call("exists", KEYS[1])
+	if redis.call("exists", KEYS[1]) == 1
 	then
 		return redis.call("hset", KEYS[1], ARGV[1], ARGV[2])
 	else
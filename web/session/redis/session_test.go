@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Moty1999/web/web/session"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_NotFound(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	store := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	_, err := store.Get(ctx, "none")
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+	assert.ErrorIs(t, store.Refresh(ctx, "none"), session.ErrSessionNotFound)
+
+	sess, err := store.Generate(ctx, "sess-1")
+	require.NoError(t, err)
+	_, err = sess.Get(ctx, "none")
+	assert.ErrorIs(t, err, session.ErrKeyNotFound)
+
+	require.NoError(t, store.Remove(ctx, "sess-1"))
+	_, err = store.Get(ctx, "sess-1")
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+	assert.ErrorIs(t, sess.Set(ctx, "a", "b"), session.ErrSessionNotFound)
+}
+
+func TestStore_RedisError(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	store := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1}))
+	mr.Close()
+
+	// redis 挂了不能当成没有 session
+	_, err := store.Get(ctx, "sess-1")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, session.ErrSessionNotFound)
+}
@@ -0,0 +1,251 @@
+package securecookie
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Moty1999/web/web/session"
+)
+
+var (
+	ErrKeyNotFound = session.ErrKeyNotFound
+	// ErrInvalidSession 解密不了, 被篡改了或者密钥已经不用了
+	// 和 ErrSessionExpired 一样, 都可以当成没有 session, errors.Is(err, session.ErrSessionNotFound) 为 true
+	ErrInvalidSession = fmt.Errorf("%w, session 无效", session.ErrSessionNotFound)
+	ErrSessionExpired = fmt.Errorf("%w, session 过期了", session.ErrSessionNotFound)
+	// ErrTooLarge 编码之后超过了 cookie 的大小限制, 数据要少放一点, 或者换成 redis
+	ErrTooLarge = errors.New("session: session 太大了, 超过了 cookie 的大小限制")
+)
+
+// Store 把整个 Session 用 AES-GCM 加密之后放到 cookie 里面, 服务端不需要存任何东西
+// GCM 本身就带了签名, 被篡改的话解密会失败
+// 因为没有服务端的状态, Remove 只能让客户端删掉 cookie, 没有办法让已经泄露的 cookie 失效
+// 数据是用 JSON 编码的, 读出来的数字是 float64, 结构体是 map[string]any
+type Store struct {
+	// 第一个用来加密, 所有的都可以用来解密, 这样换密钥的时候旧的 cookie 还能用
+	aeads      []cipher.AEAD
+	expiration time.Duration
+	maxSize    int
+
+	now func() time.Time
+}
+
+type StoreOption func(store *Store)
+
+// NewStore key 的长度必须是 16, 24 或者 32, 对应 AES-128, AES-192, AES-256
+func NewStore(key []byte, opts ...StoreOption) *Store {
+	res := &Store{
+		aeads:      []cipher.AEAD{newAEAD(key)},
+		expiration: time.Minute * 15,
+		// 浏览器限制一个 cookie 最多 4096 个字节, 还要留点给名字和属性
+		maxSize: 3800,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// StoreWithOldKeys 换密钥的时候, 把旧的密钥放在这里, 用旧密钥加密的 cookie 下一次写回去就换成新的了
+func StoreWithOldKeys(keys ...[]byte) StoreOption {
+	return func(store *Store) {
+		for _, key := range keys {
+			store.aeads = append(store.aeads, newAEAD(key))
+		}
+	}
+}
+
+func StoreWithExpiration(expiration time.Duration) StoreOption {
+	return func(store *Store) {
+		store.expiration = expiration
+	}
+}
+
+// StoreWithMaxSize 编码之后最多多少个字节
+func StoreWithMaxSize(size int) StoreOption {
+	return func(store *Store) {
+		store.maxSize = size
+	}
+}
+
+func newAEAD(key []byte) cipher.AEAD {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(fmt.Sprintf("web: securecookie 的密钥不对 %v", err))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(fmt.Sprintf("web: securecookie 的密钥不对 %v", err))
+	}
+	return aead
+}
+
+// Generate 这时候还没有写到响应里面, Manager.InitSession 会调用 Save
+func (s *Store) Generate(ctx context.Context, id string) (session.Session, error) {
+	return &Session{
+		store:  s,
+		id:     id,
+		values: make(map[string]any, 4),
+	}, nil
+}
+
+// Refresh 只能检查一下有没有过期, 顺延过期时间要重新写回响应, Manager.RefreshSession 会调用 Save
+func (s *Store) Refresh(ctx context.Context, val string) error {
+	_, err := s.decode(val)
+	return err
+}
+
+// Remove 服务端没有东西可以删, Manager.RemoveSession 会让客户端删掉 cookie
+func (s *Store) Remove(ctx context.Context, val string) error {
+	return nil
+}
+
+// Get val 是 cookie 里面的值, 也就是编码之后的整个 Session
+func (s *Store) Get(ctx context.Context, val string) (session.Session, error) {
+	p, err := s.decode(val)
+	if err != nil {
+		return nil, err
+	}
+	if p.Values == nil {
+		p.Values = make(map[string]any, 4)
+	}
+	return &Session{
+		store:  s,
+		id:     p.ID,
+		values: p.Values,
+	}, nil
+}
+
+// payload 加密之前的数据, 过期时间也在里面, 不能只靠 cookie 的 Expires, 客户端是可以改的
+type payload struct {
+	ID      string         `json:"id"`
+	Expires int64          `json:"exp"`
+	Values  map[string]any `json:"values,omitempty"`
+}
+
+func (s *Store) encode(p payload) (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	aead := s.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	res := base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, nil))
+	if len(res) > s.maxSize {
+		return "", fmt.Errorf("%w, %d 个字节, 最多 %d 个字节", ErrTooLarge, len(res), s.maxSize)
+	}
+	return res, nil
+}
+
+func (s *Store) decode(val string) (payload, error) {
+	var p payload
+	// 太长的直接不要, 省得白白解密
+	if len(val) > s.maxSize {
+		return p, ErrInvalidSession
+	}
+	data, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil {
+		return p, ErrInvalidSession
+	}
+	var plain []byte
+	for _, aead := range s.aeads {
+		if len(data) < aead.NonceSize() {
+			continue
+		}
+		plain, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+		if err == nil {
+			break
+		}
+	}
+	if plain == nil {
+		return p, ErrInvalidSession
+	}
+	if err = json.Unmarshal(plain, &p); err != nil {
+		return p, ErrInvalidSession
+	}
+	if !s.now().Before(time.Unix(p.Expires, 0)) {
+		return p, ErrSessionExpired
+	}
+	return p, nil
+}
+
+type Session struct {
+	store *Store
+	id    string
+
+	mutex  sync.RWMutex
+	values map[string]any
+	inject func(val string) error
+}
+
+func (s *Session) Get(ctx context.Context, key string) (any, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	val, ok := s.values[key]
+	if !ok {
+		return nil, fmt.Errorf("%w, key %s", ErrKeyNotFound, key)
+	}
+	return val, nil
+}
+
+// Set 修改之后马上写回响应, 超过大小限制的话返回 ErrTooLarge, 并且不会修改
+// 每次 Set 都要重新编码加密整个 Session, 一个请求里面要改好几个 key 的话,
+// 最好放到一个结构体或者 map 里面一次 Set 进去
+func (s *Session) Set(ctx context.Context, key string, val any) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	old, ok := s.values[key]
+	s.values[key] = val
+	if err := s.save(); err != nil {
+		if ok {
+			s.values[key] = old
+		} else {
+			delete(s.values, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+func (s *Session) Bind(inject func(val string) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inject = inject
+}
+
+func (s *Session) Save(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.save()
+}
+
+func (s *Session) save() error {
+	if s.inject == nil {
+		return errors.New("session: Session 没有绑定响应, 要通过 session.Manager 获取")
+	}
+	val, err := s.store.encode(payload{
+		ID:      s.id,
+		Expires: s.store.now().Add(s.store.expiration).Unix(),
+		Values:  s.values,
+	})
+	if err != nil {
+		return err
+	}
+	return s.inject(val)
+}
@@ -0,0 +1,231 @@
+package securecookie
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Moty1999/web/web"
+	"github.com/Moty1999/web/web/session"
+	"github.com/Moty1999/web/web/session/cookie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	key1 = []byte("0123456789abcdef0123456789abcdef")
+	key2 = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestStore_Manager(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewStore(key1, StoreWithExpiration(time.Minute))
+	store.now = func() time.Time { return now }
+	m := &session.Manager{
+		Propagator: cookie.NewPropagator(cookie.WithCookieOption(func(c *http.Cookie) {
+			c.Path = "/"
+			c.HttpOnly = true
+		})),
+		Store:      store,
+		CtxSessKey: "sess",
+	}
+
+	server := web.NewHTTPServer()
+	server.Post("/login", func(ctx *web.Context) {
+		sess, err := m.InitSession(ctx)
+		require.NoError(t, err)
+		require.NoError(t, sess.Set(ctx.Req.Context(), "nickname", "tom"))
+		// 中间写的别的 cookie 不能被去掉
+		http.SetCookie(ctx.Resp, &http.Cookie{Name: "sessid_hint", Value: "1"})
+		require.NoError(t, sess.Set(ctx.Req.Context(), "age", 18))
+	})
+	server.Get("/user", func(ctx *web.Context) {
+		sess, err := m.GetSession(ctx)
+		if err != nil {
+			ctx.RespString(http.StatusUnauthorized, err.Error())
+			return
+		}
+		nickname, err := sess.Get(ctx.Req.Context(), "nickname")
+		require.NoError(t, err)
+		age, err := sess.Get(ctx.Req.Context(), "age")
+		require.NoError(t, err)
+		_, err = sess.Get(ctx.Req.Context(), "none")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		// JSON 编码之后数字是 float64
+		ctx.RespString(http.StatusOK, fmt.Sprintf("%s %v", nickname, age.(float64)))
+	})
+	server.Post("/refresh", func(ctx *web.Context) {
+		require.NoError(t, m.RefreshSession(ctx))
+	})
+	server.Post("/logout", func(ctx *web.Context) {
+		require.NoError(t, m.RemoveSession(ctx))
+	})
+
+	do := func(method, path string, c *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if c != nil {
+			req.AddCookie(c)
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	resp := do(http.MethodPost, "/login", nil)
+	// 改了好几次, 只有最后一次的 Set-Cookie
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "sessid_hint", cookies[0].Name)
+	c := cookies[1]
+	assert.Equal(t, "sessid", c.Name)
+	assert.True(t, c.HttpOnly)
+	assert.NotContains(t, c.Value, "tom")
+
+	resp = do(http.MethodGet, "/user", c)
+	assert.Equal(t, "tom 18", resp.Body.String())
+	// 只读的话不用写回去
+	assert.Empty(t, resp.Result().Cookies())
+
+	// 被篡改了
+	tampered := &http.Cookie{Name: c.Name, Value: c.Value[:10] + "A" + c.Value[11:]}
+	if tampered.Value == c.Value {
+		tampered.Value = c.Value[:10] + "B" + c.Value[11:]
+	}
+	resp = do(http.MethodGet, "/user", tampered)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, ErrInvalidSession.Error(), resp.Body.String())
+
+	// 刷新之后过期时间顺延
+	now = now.Add(50 * time.Second)
+	resp = do(http.MethodPost, "/refresh", c)
+	cookies = resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	refreshed := cookies[0]
+
+	now = now.Add(50 * time.Second)
+	resp = do(http.MethodGet, "/user", c)
+	assert.Equal(t, ErrSessionExpired.Error(), resp.Body.String())
+	resp = do(http.MethodGet, "/user", refreshed)
+	assert.Equal(t, "tom 18", resp.Body.String())
+
+	resp = do(http.MethodPost, "/logout", refreshed)
+	cookies = resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, -1, cookies[0].MaxAge)
+	assert.Equal(t, "/", cookies[0].Path)
+}
+
+func TestStore_KeyRotation(t *testing.T) {
+	ctx := context.Background()
+	old := NewStore(key1)
+	sess, err := old.Generate(ctx, "sess-1")
+	require.NoError(t, err)
+	var val string
+	sess.(session.ClientSession).Bind(func(v string) error {
+		val = v
+		return nil
+	})
+	require.NoError(t, sess.Set(ctx, "nickname", "tom"))
+
+	// 换成新的密钥, 旧的还能解密
+	rotated := NewStore(key2, StoreWithOldKeys(key1))
+	sess, err = rotated.Get(ctx, val)
+	require.NoError(t, err)
+	assert.Equal(t, "sess-1", sess.ID())
+	nickname, err := sess.Get(ctx, "nickname")
+	require.NoError(t, err)
+	assert.Equal(t, "tom", nickname)
+
+	// 写回去的是用新密钥加密的
+	sess.(session.ClientSession).Bind(func(v string) error {
+		val = v
+		return nil
+	})
+	require.NoError(t, sess.(session.ClientSession).Save(ctx))
+	_, err = old.Get(ctx, val)
+	assert.ErrorIs(t, err, ErrInvalidSession)
+	_, err = NewStore(key2).Get(ctx, val)
+	assert.NoError(t, err)
+
+	// 旧密钥不要了之后就解密不了了
+	_, err = NewStore(key2).Get(ctx, "")
+	assert.ErrorIs(t, err, ErrInvalidSession)
+	_, err = NewStore(key2).Get(ctx, "!!!")
+	assert.ErrorIs(t, err, ErrInvalidSession)
+}
+
+func TestSession_Set(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(key1, StoreWithMaxSize(200))
+	sess, err := store.Generate(ctx, "sess-1")
+	require.NoError(t, err)
+
+	// 没有绑定响应
+	assert.Error(t, sess.Set(ctx, "a", "b"))
+	_, err = sess.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	var val string
+	sess.(session.ClientSession).Bind(func(v string) error {
+		val = v
+		return nil
+	})
+	require.NoError(t, sess.Set(ctx, "a", "b"))
+
+	// 太大了, 不会修改
+	err = sess.Set(ctx, "a", strings.Repeat("x", 200))
+	assert.ErrorIs(t, err, ErrTooLarge)
+	err = sess.Set(ctx, "c", strings.Repeat("x", 200))
+	assert.ErrorIs(t, err, ErrTooLarge)
+	a, err := sess.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "b", a)
+	_, err = sess.Get(ctx, "c")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	got, err := store.Get(ctx, val)
+	require.NoError(t, err)
+	a, err = got.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "b", a)
+	assert.NoError(t, store.Refresh(ctx, val))
+	assert.NoError(t, store.Remove(ctx, val))
+}
+
+func TestStore_NotFound(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	store := NewStore(key1, StoreWithExpiration(time.Minute))
+	store.now = func() time.Time { return now }
+	sess, err := store.Generate(ctx, "sess-1")
+	require.NoError(t, err)
+	var val string
+	sess.(session.ClientSession).Bind(func(v string) error {
+		val = v
+		return nil
+	})
+	require.NoError(t, sess.(session.ClientSession).Save(ctx))
+	_, err = sess.Get(ctx, "none")
+	assert.ErrorIs(t, err, session.ErrKeyNotFound)
+
+	// 无效的和过期的都当成没有 session
+	_, err = store.Get(ctx, "abc")
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+	now = now.Add(time.Minute)
+	_, err = store.Get(ctx, val)
+	assert.ErrorIs(t, err, ErrSessionExpired)
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+}
+
+func TestNewStore(t *testing.T) {
+	assert.Panics(t, func() {
+		NewStore([]byte("short"))
+	})
+	assert.Panics(t, func() {
+		NewStore(key1, StoreWithOldKeys([]byte("short")))
+	})
+}
@@ -2,9 +2,18 @@ package session
 
 import (
 	"context"
+	"errors"
 	"net/http"
 )
 
+// ErrSessionNotFound 请求里面没有 session, 或者 session 已经过期, 无效了
+// Propagator 和 Store 找不到 session 的时候返回的 error 要能用 errors.Is 判断出来
+// 这样用的人可以把 "没有 session" 和 redis 挂了之类的错误区分开
+var ErrSessionNotFound = errors.New("session: 找不到 session")
+
+// ErrKeyNotFound Session 里面没有这个 key, Session.Get 返回的 error 要能用 errors.Is 判断出来
+var ErrKeyNotFound = errors.New("session: 找不到 key")
+
 // Store 管理 Session 本身
 type Store interface {
 	// session 对应的 ID 谁来指定?
@@ -23,8 +32,25 @@ type Session interface {
 	ID() string
 }
 
+// ClientSession 数据保存在客户端的 Session, 例如 securecookie
+// 没有服务端的状态, 每次修改之后都要把编码之后的整个 Session 重新写回响应
+type ClientSession interface {
+	Session
+	// Bind Manager 拿到 Session 之后调用, Session 通过 inject 把编码之后的自己写回响应
+	Bind(inject func(val string) error)
+	// Save 重新编码写回响应, 过期时间也会顺延
+	Save(ctx context.Context) error
+}
+
 type Propagator interface {
 	Inject(id string, writer http.ResponseWriter) error
 	Extract(req *http.Request) (string, error)
 	Remove(writer http.ResponseWriter) error
 }
+
+// CookiePropagator 用 cookie 传递 session 的 Propagator
+// ClientSession 在同一个请求里面重新写回的时候, Manager 按照名字去掉前面写的 Set-Cookie
+type CookiePropagator interface {
+	Propagator
+	CookieName() string
+}
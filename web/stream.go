@@ -0,0 +1,150 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stream 流式输出响应, 用于长轮询, 进度推送之类的场景
+// step 每调用一次就 Flush 一次, 返回 false 代表结束
+// 返回值为 true 说明客户端已经断开了
+// 开始 Stream 之后, RespData 就不会再写到响应里面了, 但是 RespStatusCode 和 RespSize 还是准的
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	w := c.streamWriter()
+	done := c.Req.Context().Done()
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+		}
+		keepOpen := step(w)
+		_ = c.Flush()
+		if !keepOpen {
+			return false
+		}
+	}
+}
+
+// Flush 把已经写出去的数据立刻发给客户端
+// 底层的 ResponseWriter 不支持的话返回 http.ErrNotSupported
+func (c *Context) Flush() error {
+	c.commit()
+	return http.NewResponseController(c.Resp).Flush()
+}
+
+// RespSize 响应体的大小
+// 流式输出的时候是已经写出去的字节数, 否则就是 RespData 的长度
+func (c *Context) RespSize() int {
+	if c.committed {
+		return c.respSize
+	}
+	return len(c.RespData)
+}
+
+// commit 把响应头写出去, 之后 flashResp 不会再写 RespData
+func (c *Context) commit() {
+	if c.committed {
+		return
+	}
+	c.committed = true
+	if c.RespStatusCode == 0 {
+		c.RespStatusCode = http.StatusOK
+	}
+	c.Resp.WriteHeader(c.RespStatusCode)
+}
+
+func (c *Context) streamWriter() io.Writer {
+	c.commit()
+	return respWriter{ctx: c}
+}
+
+// respWriter 直接写响应, 顺便记录写了多少字节
+type respWriter struct {
+	ctx *Context
+}
+
+func (w respWriter) Write(p []byte) (int, error) {
+	n, err := w.ctx.Resp.Write(p)
+	w.ctx.respSize += n
+	return n, err
+}
+
+// SSEvent 一个 Server-Sent Event
+type SSEvent struct {
+	// Event 事件类型, 为空的话浏览器当成 message
+	Event string
+	// ID 浏览器断线重连的时候会放在 Last-Event-ID 里面
+	ID string
+	// Retry 告诉浏览器断线之后多久重连, 0 代表不设置
+	Retry time.Duration
+	// Data 数据, 可以有多行
+	Data string
+}
+
+// SSEWriter 用来发送 Server-Sent Events
+type SSEWriter struct {
+	ctx *Context
+	w   io.Writer
+}
+
+// SSE 开始一个 Server-Sent Events 响应
+func (c *Context) SSE() *SSEWriter {
+	header := c.Resp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 告诉 nginx 之类的代理不要缓冲
+	header.Set("X-Accel-Buffering", "no")
+	return &SSEWriter{
+		ctx: c,
+		w:   c.streamWriter(),
+	}
+}
+
+// Send 发送一个事件, 发完立刻 Flush
+func (s *SSEWriter) Send(ev SSEvent) error {
+	var sb strings.Builder
+	if ev.ID != "" {
+		writeSSEField(&sb, "id", ev.ID)
+	}
+	if ev.Event != "" {
+		writeSSEField(&sb, "event", ev.Event)
+	}
+	if ev.Retry > 0 {
+		writeSSEField(&sb, "retry", strconv.FormatInt(ev.Retry.Milliseconds(), 10))
+	}
+	for _, line := range strings.Split(ev.Data, "\n") {
+		writeSSEField(&sb, "data", line)
+	}
+	sb.WriteByte('\n')
+	return s.write(sb.String())
+}
+
+// Comment 发送注释, 浏览器会忽略, 一般用来做心跳, 防止连接被代理断开
+func (s *SSEWriter) Comment(text string) error {
+	return s.write(": " + text + "\n\n")
+}
+
+// Done 客户端断开之后会被关闭
+func (s *SSEWriter) Done() <-chan struct{} {
+	return s.ctx.Req.Context().Done()
+}
+
+func (s *SSEWriter) write(data string) error {
+	if _, err := io.WriteString(s.w, data); err != nil {
+		return err
+	}
+	return s.ctx.Flush()
+}
+
+// writeSSEField 写一行, 去掉 \r, 防止把一行拆成两行
+func writeSSEField(sb *strings.Builder, name string, val string) {
+	sb.WriteString(name)
+	sb.WriteString(": ")
+	sb.WriteString(strings.ReplaceAll(val, "\r", ""))
+	sb.WriteByte('\n')
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_Stream(t *testing.T) {
+	var status, size int
+	server := NewHTTPServer(ServerWithMiddleware(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			status = ctx.RespStatusCode
+			size = ctx.RespSize()
+		}
+	}))
+	server.Get("/progress", func(ctx *Context) {
+		i := 0
+		clientGone := ctx.Stream(func(w io.Writer) bool {
+			i++
+			_, _ = fmt.Fprintf(w, "%d%%\n", i*25)
+			return i < 4
+		})
+		assert.False(t, clientGone)
+		// 已经流式输出了, 这个不会被写出去
+		ctx.RespData = []byte("ignored")
+	})
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/progress", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "25%\n50%\n75%\n100%\n", recorder.Body.String())
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, len("25%\n50%\n75%\n100%\n"), size)
+}
+
+func TestContext_StreamClientGone(t *testing.T) {
+	server := NewHTTPServer()
+	var steps int
+	var clientGone bool
+	server.Get("/progress", func(ctx *Context) {
+		clientGone = ctx.Stream(func(w io.Writer) bool {
+			steps++
+			return true
+		})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/progress", nil).WithContext(ctx)
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, clientGone)
+	assert.Equal(t, 0, steps)
+}
+
+func TestContext_SSE(t *testing.T) {
+	server := NewHTTPServer()
+	server.Get("/events", func(ctx *Context) {
+		sse := ctx.SSE()
+		require.NoError(t, sse.Send(SSEvent{
+			ID:    "1",
+			Event: "progress",
+			Retry: 3 * time.Second,
+			Data:  "first line\nsecond line",
+		}))
+		require.NoError(t, sse.Comment("ping"))
+		require.NoError(t, sse.Send(SSEvent{Data: "done"}))
+	})
+
+	// 用真正的服务器, 确认每个事件都是立刻发出去的
+	s := httptest.NewServer(server)
+	defer s.Close()
+	resp, err := http.Get(s.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Equal(t, []string{
+		"id: 1",
+		"event: progress",
+		"retry: 3000",
+		"data: first line",
+		"data: second line",
+		"",
+		": ping",
+		"",
+		"data: done",
+		"",
+	}, lines)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"html/template"
+	"maps"
 )
 
 type TemplateEngine interface {
@@ -24,16 +25,45 @@ type TemplateEngine interface {
 	//AddTemplate(tplName string, tpl []byte) error
 }
 
+// GoTemplateEngine 模板和模板函数都是启动的时候准备好的, 渲染的时候不会再改
+// 需要和请求相关的值, 例如 csrf 的 token, CSP 的 nonce, 模板函数自己从请求的 context 里面读
+// Render 会把请求的 context 放到 data 的 Ctx 里面, data 是 nil 或者 map[string]any 的时候不用自己放,
+// 结构体的话要自己加一个 Ctx 字段. 多个中间件的函数可以一起注册:
+//
+//	tpl := template.Must(template.New("").
+//		Funcs(csrfBuilder.FuncMap()).
+//		Funcs(secure.FuncMap()).
+//		ParseGlob("views/*.gohtml"))
+//
+//	ctx.Render("form", nil)
+//	<script nonce="{{ cspNonce .Ctx }}"></script><form>{{ csrfField .Ctx }}</form>
 type GoTemplateEngine struct {
 	T *template.Template
 }
 
 func (g *GoTemplateEngine) Render(ctx context.Context, tplName string, data any) ([]byte, error) {
 	bs := &bytes.Buffer{}
-	err := g.T.ExecuteTemplate(bs, tplName, data)
+	err := g.T.ExecuteTemplate(bs, tplName, withCtx(ctx, data))
 	return bs.Bytes(), err
 }
 
+// withCtx 复制一份再放, 不改用户传进来的 map, 用户自己放了 Ctx 的话就用用户的
+func withCtx(ctx context.Context, data any) any {
+	switch d := data.(type) {
+	case nil:
+		return map[string]any{"Ctx": ctx}
+	case map[string]any:
+		if _, ok := d["Ctx"]; ok {
+			return d
+		}
+		res := make(map[string]any, len(d)+1)
+		maps.Copy(res, d)
+		res["Ctx"] = ctx
+		return res
+	}
+	return data
+}
+
 func (g *GoTemplateEngine) ParseGlob(pattern string) error {
 	var err error
 	g.T, err = template.ParseGlob(pattern)
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tplCtxKey struct{}
+
+func TestGoTemplateEngine_Render(t *testing.T) {
+	// 模板函数只注册一次, 从请求的 context 里面读
+	tpl, err := template.New("").Funcs(template.FuncMap{
+		"user": func(ctx context.Context) string {
+			user, _ := ctx.Value(tplCtxKey{}).(string)
+			return user
+		},
+	}).Parse(`{{ define "page" }}{{ user .Ctx }} {{ .Name }}{{ end }}`)
+	require.NoError(t, err)
+
+	server := NewHTTPServer(ServerWithTemplateEngine(&GoTemplateEngine{T: tpl}),
+		ServerWithMiddleware(func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				ctx.Req = ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), tplCtxKey{}, ctx.Req.URL.Query().Get("user")))
+				next(ctx)
+			}
+		}))
+	data := map[string]any{"Name": "page"}
+	server.Get("/nil", func(ctx *Context) {
+		_ = ctx.Render("page", nil)
+	})
+	server.Get("/map", func(ctx *Context) {
+		_ = ctx.Render("page", data)
+	})
+	server.Get("/struct", func(ctx *Context) {
+		_ = ctx.Render("page", struct {
+			Ctx  context.Context
+			Name string
+		}{Ctx: ctx.Req.Context(), Name: "struct"})
+	})
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantBody string
+	}{
+		{name: "nil", path: "/nil?user=Tom", wantBody: "Tom "},
+		{name: "map", path: "/map?user=Tom", wantBody: "Tom page"},
+		// 每个请求的值都不一样
+		{name: "map another", path: "/map?user=Jerry", wantBody: "Jerry page"},
+		{name: "struct", path: "/struct?user=Tom", wantBody: "Tom struct"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+	// 用户的 map 没有被修改
+	assert.Equal(t, map[string]any{"Name": "page"}, data)
+}
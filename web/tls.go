@@ -0,0 +1,114 @@
+package web
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ServerWithTLSConfig 设置 TLS 配置
+// 证书放在 Certificates 里面的话, StartTLS 和 ServeTLS 的证书文件可以传空字符串
+func ServerWithTLSConfig(cfg *tls.Config) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.server.TLSConfig = cfg
+	}
+}
+
+// ServerWithH2C 在明文连接上支持 HTTP/2, 一般用于内部服务之间的调用
+// TLS 连接上面的 HTTP/2 是默认开启的, 不需要这个选项
+func ServerWithH2C() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.server.Handler = h2c.NewHandler(server, &http2.Server{})
+	}
+}
+
+// ServerWithHTTPSRedirect 在 addr 上面额外监听 HTTP 请求, 全部跳转到 HTTPS
+// 只有 StartTLS 和 ServeTLS 才会启动
+func ServerWithHTTPSRedirect(addr string) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.redirectAddr = addr
+	}
+}
+
+// StartTLS 监听 addr, 处理 HTTPS 请求, 客户端支持的话会使用 HTTP/2
+func (h *HTTPServer) StartTLS(addr string, certFile string, keyFile string) error {
+	listen, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return h.ServeTLS(certFile, keyFile, listen)
+}
+
+// ServeTLS 和 Serve 一样, 只不过处理的是 HTTPS 请求
+func (h *HTTPServer) ServeTLS(certFile string, keyFile string, listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("web: 至少需要一个 listener")
+	}
+	if h.redirectAddr != "" {
+		if err := h.startRedirect(listeners[0]); err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return err
+		}
+	}
+
+	err := h.serveAll(listeners, func(l net.Listener) error {
+		return h.server.ServeTLS(l, certFile, keyFile)
+	})
+	// 不是 Shutdown 导致的退出, 跳转的服务器也要关掉
+	if rs := h.getRedirectServer(); rs != nil && !errors.Is(err, http.ErrServerClosed) {
+		_ = rs.Close()
+	}
+	return err
+}
+
+// startRedirect 启动跳转服务器, 跳转到 tlsListener 的端口上
+func (h *HTTPServer) startRedirect(tlsListener net.Listener) error {
+	_, port, err := net.SplitHostPort(tlsListener.Addr().String())
+	if err != nil {
+		return err
+	}
+	listen, err := net.Listen("tcp", h.redirectAddr)
+	if err != nil {
+		return err
+	}
+	rs := &http.Server{
+		Handler:           httpsRedirectHandler(port),
+		ReadHeaderTimeout: h.server.ReadHeaderTimeout,
+	}
+	h.mutex.Lock()
+	h.redirectServer = rs
+	h.mutex.Unlock()
+	go func() {
+		if err := rs.Serve(listen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			h.log("HTTPS 跳转服务器退出 %v", err)
+		}
+	}()
+	return nil
+}
+
+func (h *HTTPServer) getRedirectServer() *http.Server {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.redirectServer
+}
+
+// httpsRedirectHandler 保留 host 和请求路径, 换成 https 和 port
+// 用 308 而不是 301, 这样 POST 请求跳转之后还是 POST
+func httpsRedirectHandler(port string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		host := request.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(writer, request, "https://"+host+request.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestHTTPServer_ServeTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+	redirectAddr := freeAddr(t)
+	server := NewHTTPServer(
+		ServerWithTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		ServerWithHTTPSRedirect(redirectAddr),
+	)
+	server.Get("/proto", func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte(ctx.Req.Proto)
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ServeTLS("", "", l)
+	}()
+	defer func() {
+		require.NoError(t, server.Shutdown(context.Background()))
+		assert.ErrorIs(t, <-serveErr, http.ErrServerClosed)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get("https://" + l.Addr().String() + "/proto")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", readBody(t, resp))
+
+	// HTTP 跳转到 HTTPS
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		resp, err = client.Get("http://" + redirectAddr + "/proto?a=b")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://127.0.0.1:"+port+"/proto?a=b", resp.Header.Get("Location"))
+}
+
+func TestHTTPServer_H2C(t *testing.T) {
+	server := NewHTTPServer(ServerWithH2C())
+	server.Get("/proto", func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte(ctx.Req.Proto)
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(l)
+	}()
+	defer func() {
+		_ = server.Shutdown(context.Background())
+	}()
+
+	// 明文的 HTTP/2 客户端
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+	resp, err := client.Get("http://" + l.Addr().String() + "/proto")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", readBody(t, resp))
+
+	// HTTP/1.1 照样可以用
+	resp, err = http.Get("http://" + l.Addr().String() + "/proto")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", readBody(t, resp))
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// freeAddr 找一个空闲的端口
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+// selfSignedCert 测试的时候生成自签名证书
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"web test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+}
@@ -0,0 +1,376 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidateRule 校验规则, param 是规则等号后面的部分, 例如 min=1 里面的 1
+// val 已经去掉了指针, 返回 false 代表校验不通过
+type ValidateRule func(val reflect.Value, param string) bool
+
+var validateRules = struct {
+	mutex sync.RWMutex
+	rules map[string]ValidateRule
+}{
+	rules: map[string]ValidateRule{
+		"required": func(val reflect.Value, param string) bool {
+			return !val.IsZero()
+		},
+		"min": func(val reflect.Value, param string) bool {
+			n, ok := sizeOf(val)
+			return ok && n >= mustParseFloat(param)
+		},
+		"max": func(val reflect.Value, param string) bool {
+			n, ok := sizeOf(val)
+			return ok && n <= mustParseFloat(param)
+		},
+		"len": func(val reflect.Value, param string) bool {
+			n, ok := sizeOf(val)
+			return ok && n == mustParseFloat(param)
+		},
+		"email": func(val reflect.Value, param string) bool {
+			if val.Kind() != reflect.String {
+				return false
+			}
+			addr, err := mail.ParseAddress(val.String())
+			// 不接受 "Tom <tom@example.com>" 这种格式
+			return err == nil && addr.Address == val.String()
+		},
+		"oneof": func(val reflect.Value, param string) bool {
+			s, ok := stringOf(val)
+			if !ok {
+				return false
+			}
+			for _, option := range strings.Fields(param) {
+				if s == option {
+					return true
+				}
+			}
+			return false
+		},
+	},
+}
+
+// RegisterValidateRule 注册自定义的校验规则, 同名的会覆盖掉
+// 要在第一次校验之前注册
+func RegisterValidateRule(name string, rule ValidateRule) {
+	validateRules.mutex.Lock()
+	defer validateRules.mutex.Unlock()
+	validateRules.rules[name] = rule
+}
+
+func validateRuleOf(name string) (ValidateRule, bool) {
+	validateRules.mutex.RLock()
+	defer validateRules.mutex.RUnlock()
+	rule, ok := validateRules.rules[name]
+	return rule, ok
+}
+
+// sizeOf 数字就是它本身, 字符串是字符数, 切片和 map 是长度
+func sizeOf(val reflect.Value) (float64, bool) {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(val.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(val.Len()), true
+	}
+	return 0, false
+}
+
+// stringOf 用 Kind 对应的方法取值, 不用 Interface, 没有导出的组合字段调用 Interface 会 panic
+func stringOf(val reflect.Value) (string, bool) {
+	switch val.Kind() {
+	case reflect.String:
+		return val.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(val.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(val.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(val.Float(), 'g', -1, 64), true
+	case reflect.Bool:
+		return strconv.FormatBool(val.Bool()), true
+	}
+	return "", false
+}
+
+// numericRules 参数必须是数字的规则, 解析元数据的时候就检查好, 执行的时候 mustParseFloat 不会 panic
+var numericRules = map[string]struct{}{"min": {}, "max": {}, "len": {}}
+
+func mustParseFloat(param string) float64 {
+	f, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("web: 校验规则的参数 %s 不是数字", param))
+	}
+	return f
+}
+
+// FieldError 一个字段没有通过校验
+type FieldError struct {
+	// Field 字段的路径, 例如 items[0].name, 优先使用 json 标签里面的名字
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+func (e *FieldError) Error() string {
+	if e.Param == "" {
+		return fmt.Sprintf("web: 字段 %s 不满足 %s", e.Field, e.Rule)
+	}
+	return fmt.Sprintf("web: 字段 %s 不满足 %s=%s", e.Field, e.Rule, e.Param)
+}
+
+// ValidationErrors 所有没有通过校验的字段
+type ValidationErrors []*FieldError
+
+func (es ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate 按照 validate 标签校验结构体, 会校验组合, 嵌套的结构体以及结构体切片
+//
+//	type Req struct {
+//		Name  string   `json:"name" validate:"required,max=64"`
+//		Email string   `json:"email" validate:"omitempty,email"`
+//		Role  string   `json:"role" validate:"oneof=admin user"`
+//		Items []Item   `json:"items" validate:"min=1"`
+//	}
+//
+// omitempty 代表零值的时候跳过其它规则
+// 校验不通过的时候返回 ValidationErrors
+// 标签写错了(例如未知的规则)返回普通的 error, 结果会缓存起来, 不会每次都解析
+func Validate(val any) error {
+	rv := reflect.ValueOf(val)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("web: 只能校验结构体, 输入是 %s", rv.Kind())
+	}
+	var errs ValidationErrors
+	if err := validateStruct(rv, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(rv reflect.Value, path string, errs *ValidationErrors) error {
+	m, err := validateModelOf(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, fd := range m.fields {
+		fdPath := fd.name
+		if path != "" {
+			fdPath = path + "." + fd.name
+		}
+		if err = validateValue(rv.FieldByIndex(fd.index), fd, fdPath, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateValue(val reflect.Value, fd *validateField, path string, errs *ValidationErrors) error {
+	if fd.omitEmpty && val.IsZero() {
+		return nil
+	}
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			// 只有 required 对 nil 有意义
+			if fd.required {
+				*errs = append(*errs, &FieldError{Field: path, Rule: "required"})
+			}
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	for _, r := range fd.rules {
+		if !r.fn(val, r.param) {
+			*errs = append(*errs, &FieldError{Field: path, Rule: r.name, Param: r.param})
+			// 一个字段只报第一个错误
+			return nil
+		}
+	}
+	return validateNested(val, path, errs)
+}
+
+// validateNested 继续校验嵌套的结构体和结构体切片
+func validateNested(val reflect.Value, path string, errs *ValidationErrors) error {
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	switch val.Kind() {
+	case reflect.Struct:
+		if val.Type() != timeType {
+			return validateStruct(val, path, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			if err := validateNested(val.Index(i), path+"["+strconv.Itoa(i)+"]", errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type validateModel struct {
+	fields []*validateField
+	// 标签写错了, 也缓存起来
+	err error
+}
+
+type validateField struct {
+	// 字段在路径里面的名字
+	name      string
+	index     []int
+	required  bool
+	omitEmpty bool
+	rules     []validateRuleMeta
+}
+
+type validateRuleMeta struct {
+	name  string
+	param string
+	fn    ValidateRule
+}
+
+var validateModels sync.Map
+
+// validateModelOf 第一次用到的时候解析并且检查标签, 出错了也缓存起来
+func validateModelOf(typ reflect.Type) (*validateModel, error) {
+	if m, ok := validateModels.Load(typ); ok {
+		m := m.(*validateModel)
+		return m, m.err
+	}
+	m := &validateModel{}
+	if err := parseValidateFields(typ, nil, m); err != nil {
+		m = &validateModel{err: err}
+	}
+	validateModels.Store(typ, m)
+	return m, m.err
+}
+
+func parseValidateFields(typ reflect.Type, index []int, m *validateModel) error {
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		fdIndex := append(append([]int{}, index...), i)
+		tag, hasTag := fd.Tag.Lookup("validate")
+		// 组合进来的结构体, 字段当成自己的
+		if fd.Anonymous && !hasTag && fd.Type.Kind() == reflect.Struct {
+			if err := parseValidateFields(fd.Type, fdIndex, m); err != nil {
+				return err
+			}
+			continue
+		}
+		if !fd.IsExported() || tag == "-" {
+			continue
+		}
+
+		vf := &validateField{
+			name:  fieldPathName(fd),
+			index: fdIndex,
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			rule = strings.TrimSpace(rule)
+			name, param, _ := strings.Cut(rule, "=")
+			switch name {
+			case "":
+				continue
+			case "omitempty":
+				vf.omitEmpty = true
+				continue
+			case "required":
+				vf.required = true
+			}
+			fn, ok := validateRuleOf(name)
+			if !ok {
+				return fmt.Errorf("web: %s 的字段 %s 使用了未知的校验规则 %s", typ, fd.Name, name)
+			}
+			if _, ok = numericRules[name]; ok {
+				if _, err := strconv.ParseFloat(param, 64); err != nil {
+					return fmt.Errorf("web: %s 的字段 %s 的校验规则 %s 的参数不是数字 %q", typ, fd.Name, name, param)
+				}
+			}
+			vf.rules = append(vf.rules, validateRuleMeta{name: name, param: param, fn: fn})
+		}
+		m.fields = append(m.fields, vf)
+	}
+	return nil
+}
+
+// fieldPathName 前端认识的是 json 或者绑定标签里面的名字, 都没有才用字段名
+func fieldPathName(fd reflect.StructField) string {
+	if name, _, _ := strings.Cut(fd.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	for _, source := range bindSources {
+		if name := fd.Tag.Get(source); name != "" && name != "-" {
+			return name
+		}
+	}
+	return fd.Name
+}
+
+// BindOrReject 绑定并且校验, 失败的话返回 JSON 响应, 并且返回 false
+// Content-Type 不支持的话是 415, 别的都是 400, 错误的细节(例如解码器的报错)不会返回给前端
+// 校验失败的响应:
+//
+//	{"message":"参数校验失败","errors":[{"field":"items[0].name","rule":"required"}]}
+func (c *Context) BindOrReject(val any) bool {
+	err := c.Bind(val)
+	if err == nil {
+		return true
+	}
+	status, resp := http.StatusBadRequest, validateResp{Message: "参数格式不对"}
+	var (
+		errs    ValidationErrors
+		bindErr *BindError
+	)
+	switch {
+	case errors.As(err, &errs):
+		resp.Message = "参数校验失败"
+		resp.Errors = errs
+	case errors.As(err, &bindErr):
+		// 标签里面的名字是前端传过来的, 可以告诉前端
+		resp.Message = fmt.Sprintf("参数 %s 格式不对", bindErr.Key)
+	case errors.Is(err, ErrUnsupportedMediaType):
+		status, resp.Message = http.StatusUnsupportedMediaType, "不支持的 Content-Type"
+	}
+	_ = c.RespJSON(status, resp)
+	return false
+}
+
+type validateResp struct {
+	Message string           `json:"message"`
+	Errors  ValidationErrors `json:"errors,omitempty"`
+}
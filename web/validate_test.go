@@ -0,0 +1,264 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validateAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type validateItem struct {
+	Name  string `json:"name" validate:"required,max=4"`
+	Count int    `json:"count" validate:"min=1"`
+}
+
+type validateBase struct {
+	Page int `query:"page" validate:"omitempty,min=1,max=100"`
+}
+
+type validateReq struct {
+	validateBase
+	Name     string           `json:"name" validate:"required,min=2,max=8"`
+	Email    string           `json:"email" validate:"omitempty,email"`
+	Role     string           `json:"role" validate:"oneof=admin user"`
+	Level    int              `json:"level" validate:"oneof=1 2 3"`
+	Nickname *string          `json:"nickname" validate:"required,min=1"`
+	Address  *validateAddress `json:"address"`
+	Items    []validateItem   `json:"items" validate:"min=1"`
+	Phone    string           `validate:"phone"`
+	Skip     string           `json:"skip" validate:"-"`
+}
+
+func TestValidate(t *testing.T) {
+	RegisterValidateRule("phone", func(val reflect.Value, param string) bool {
+		return val.Len() == 11 && strings.HasPrefix(val.String(), "1")
+	})
+
+	nickname := "t"
+	empty := ""
+	valid := func() *validateReq {
+		return &validateReq{
+			Name:     "Tom",
+			Role:     "admin",
+			Level:    2,
+			Nickname: &nickname,
+			Items:    []validateItem{{Name: "a", Count: 1}},
+			Phone:    "13800000000",
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		req      func() *validateReq
+		wantErrs ValidationErrors
+	}{
+		{
+			name: "valid",
+			req:  valid,
+		},
+		{
+			name: "required",
+			req: func() *validateReq {
+				req := valid()
+				req.Name = ""
+				req.Nickname = nil
+				return req
+			},
+			wantErrs: ValidationErrors{
+				{Field: "name", Rule: "required"},
+				{Field: "nickname", Rule: "required"},
+			},
+		},
+		{
+			name: "min max",
+			req: func() *validateReq {
+				req := valid()
+				req.Name = "汤姆汤姆汤姆汤姆汤姆"
+				req.Nickname = &empty
+				req.Page = 101
+				req.Items = nil
+				return req
+			},
+			wantErrs: ValidationErrors{
+				{Field: "page", Rule: "max", Param: "100"},
+				{Field: "name", Rule: "max", Param: "8"},
+				{Field: "nickname", Rule: "required"},
+				{Field: "items", Rule: "min", Param: "1"},
+			},
+		},
+		{
+			name: "email oneof custom",
+			req: func() *validateReq {
+				req := valid()
+				req.Email = "Tom <tom@example.com>"
+				req.Role = "root"
+				req.Level = 4
+				req.Phone = "123"
+				return req
+			},
+			wantErrs: ValidationErrors{
+				{Field: "email", Rule: "email"},
+				{Field: "role", Rule: "oneof", Param: "admin user"},
+				{Field: "level", Rule: "oneof", Param: "1 2 3"},
+				{Field: "Phone", Rule: "phone"},
+			},
+		},
+		{
+			name: "nested",
+			req: func() *validateReq {
+				req := valid()
+				req.Address = &validateAddress{}
+				req.Items = append(req.Items, validateItem{Name: "toolong"})
+				return req
+			},
+			wantErrs: ValidationErrors{
+				{Field: "address.city", Rule: "required"},
+				{Field: "items[1].name", Rule: "max", Param: "4"},
+				{Field: "items[1].count", Rule: "min", Param: "1"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.req())
+			if tc.wantErrs == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tc.wantErrs, err)
+		})
+	}
+}
+
+func TestValidate_UnknownRule(t *testing.T) {
+	type req struct {
+		Name string `validate:"unknown"`
+	}
+	// 标签写错了返回 error, 解析的结果缓存起来, 不会每次都解析
+	err := Validate(&req{})
+	assert.ErrorContains(t, err, "unknown")
+	assert.Equal(t, err, Validate(&req{}))
+	_, ok := validateModels.Load(reflect.TypeOf(req{}))
+	assert.True(t, ok)
+
+	// 嵌套的结构体也一样
+	type outer struct {
+		Items []req
+	}
+	assert.ErrorContains(t, Validate(&outer{Items: []req{{}}}), "unknown")
+
+	type badParam struct {
+		Age int `validate:"min=abc"`
+	}
+	assert.ErrorContains(t, Validate(&badParam{}), "min")
+	assert.Error(t, Validate(1))
+}
+
+func TestValidate_OneofUnexported(t *testing.T) {
+	// 没有导出的组合字段, 调用 Interface 会 panic
+	type level int
+	type inner struct {
+		Level level   `validate:"oneof=1 2"`
+		Rate  float64 `validate:"oneof=0.5 1"`
+		OK    bool    `validate:"oneof=true"`
+	}
+	type req struct {
+		inner
+	}
+	assert.NoError(t, Validate(&req{inner: inner{Level: 2, Rate: 0.5, OK: true}}))
+	err := Validate(&req{inner: inner{Level: 3, Rate: 2}})
+	assert.Equal(t, ValidationErrors{
+		{Field: "Level", Rule: "oneof", Param: "1 2"},
+		{Field: "Rate", Rule: "oneof", Param: "0.5 1"},
+		{Field: "OK", Rule: "oneof", Param: "true"},
+	}, err)
+}
+
+func TestContext_BindOrReject(t *testing.T) {
+	type item struct {
+		Name string `json:"name" validate:"required"`
+	}
+	type req struct {
+		ID    int64  `path:"id" validate:"min=1"`
+		Items []item `json:"items"`
+	}
+
+	server := NewHTTPServer()
+	server.Post("/order/:id", func(ctx *Context) {
+		var r req
+		if !ctx.BindOrReject(&r) {
+			return
+		}
+		ctx.RespStatusCode = http.StatusOK
+	})
+
+	testCases := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:     "ok",
+			path:     "/order/1",
+			body:     `{"items":[{"name":"a"}]}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "validation failed",
+			path:     "/order/0",
+			body:     `{"items":[{"name":"a"},{}]}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"message":"参数校验失败","errors":[{"field":"id","rule":"min","param":"1"},{"field":"items[1].name","rule":"required"}]}`,
+		},
+		{
+			name:     "bind failed",
+			path:     "/order/abc",
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"message":"参数 id 格式不对"}`,
+		},
+		{
+			// 解码器的报错不能返回给前端
+			name:     "invalid body",
+			path:     "/order/1",
+			body:     `{"items":`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"message":"参数格式不对"}`,
+		},
+		{
+			name:        "unsupported media type",
+			path:        "/order/1",
+			contentType: "application/x-unknown",
+			body:        `{}`,
+			wantCode:    http.StatusUnsupportedMediaType,
+			wantBody:    `{"message":"不支持的 Content-Type"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			contentType := tc.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			r.Header.Set("Content-Type", contentType)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, r)
+			require.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrKeyNotFound 请求里面没有这个 key, 和有 key 但是值为空字符串区分开
+var ErrKeyNotFound = errors.New("web: key 不存在")
+
+// StringValue 从请求里面拿到的值, 可以连续调用转类型的方法
+// 同一个 key 有多个值的时候(例如 ?tag=a&tag=b), 转类型用的是第一个, AsSlice 拿到所有的
+type StringValue struct {
+	val  string
+	vals []string
+	err  error
+}
+
+// Exists 请求里面有没有这个 key, 值为空字符串也算有
+func (s StringValue) Exists() bool {
+	return s.err == nil
+}
+
+// Default key 不存在的时候用 val 代替, 值为空字符串不会被替换
+// 别的错误(例如解析表单失败)不会被替换, 后面转类型的时候还是会返回
+func (s StringValue) Default(val string) StringValue {
+	if !errors.Is(s.err, ErrKeyNotFound) {
+		return s
+	}
+	return StringValue{val: val, vals: []string{val}}
+}
+
+func (s StringValue) String() (string, error) {
+	return s.val, s.err
+}
+
+// AsSlice 拿到所有的值
+func (s StringValue) AsSlice() ([]string, error) {
+	return s.vals, s.err
+}
+
+func (s StringValue) AsInt() (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.Atoi(s.val)
+}
+
+func (s StringValue) AsInt64() (int64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	return strconv.ParseInt(s.val, 10, 64)
+}
+
+func (s StringValue) AsUint64() (uint64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.ParseUint(s.val, 10, 64)
+}
+
+func (s StringValue) AsFloat64() (float64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.ParseFloat(s.val, 64)
+}
+
+// AsBool 支持 1, t, true, 0, f, false 之类的写法
+func (s StringValue) AsBool() (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	return strconv.ParseBool(s.val)
+}
+
+// AsDuration 例如 300ms, 1.5h
+func (s StringValue) AsDuration() (time.Duration, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return time.ParseDuration(s.val)
+}
+
+func (s StringValue) AsTime(layout string) (time.Time, error) {
+	if s.err != nil {
+		return time.Time{}, s.err
+	}
+	return time.Parse(layout, s.val)
+}
+
+func stringValueOf(vals []string) StringValue {
+	if len(vals) == 0 {
+		return StringValue{err: ErrKeyNotFound}
+	}
+	return StringValue{val: vals[0], vals: vals}
+}
+
+// QueryValueV1 查询参数, 可以区分 ?a= 和没有 a
+func (c *Context) QueryValueV1(key string) StringValue {
+	if c.queryValues == nil {
+		c.queryValues = c.Req.URL.Query()
+	}
+	return stringValueOf(c.queryValues[key])
+}
+
+// FormValueV1 表单参数, 包括查询参数和请求体里面的表单, 请求体里面的排在前面
+func (c *Context) FormValueV1(key string) StringValue {
+	if err := c.parseForm(true); err != nil {
+		return StringValue{err: err}
+	}
+	return stringValueOf(c.Req.Form[key])
+}
+
+func (c *Context) HeaderValue(key string) StringValue {
+	return stringValueOf(c.Req.Header.Values(key))
+}
+
+func (c *Context) CookieValue(key string) StringValue {
+	var vals []string
+	for _, cookie := range c.Req.Cookies() {
+		if cookie.Name == key {
+			vals = append(vals, cookie.Value)
+		}
+	}
+	return stringValueOf(vals)
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_ValueAccessors(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost,
+		"/?page=2&empty=&tag=a&tag=b&ratio=0.5&debug=true&timeout=1.5s&since=2023-09-01&size=18446744073709551615",
+		strings.NewReader("name=Tom&tag=c"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("X-Forwarded-For", "10.0.0.1")
+	req.Header.Add("X-Forwarded-For", "10.0.0.2")
+	req.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+	ctx := &Context{Req: req}
+
+	page, err := ctx.QueryValueV1("page").AsInt()
+	require.NoError(t, err)
+	assert.Equal(t, 2, page)
+
+	size, err := ctx.QueryValueV1("size").AsUint64()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(18446744073709551615), size)
+
+	ratio, err := ctx.QueryValueV1("ratio").AsFloat64()
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, ratio)
+
+	debug, err := ctx.QueryValueV1("debug").AsBool()
+	require.NoError(t, err)
+	assert.True(t, debug)
+
+	timeout, err := ctx.QueryValueV1("timeout").AsDuration()
+	require.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, timeout)
+
+	since, err := ctx.QueryValueV1("since").AsTime(time.DateOnly)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC), since)
+
+	tags, err := ctx.QueryValueV1("tag").AsSlice()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	// 空字符串和不存在是不一样的
+	empty := ctx.QueryValueV1("empty")
+	assert.True(t, empty.Exists())
+	val, err := empty.Default("x").String()
+	require.NoError(t, err)
+	assert.Equal(t, "", val)
+
+	missing := ctx.QueryValueV1("missing")
+	assert.False(t, missing.Exists())
+	_, err = missing.AsInt()
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	limit, err := missing.Default("10").AsInt()
+	require.NoError(t, err)
+	assert.Equal(t, 10, limit)
+
+	_, err = ctx.QueryValueV1("tag").AsInt()
+	assert.Error(t, err)
+
+	// 表单里面的排在查询参数前面
+	formTags, err := ctx.FormValueV1("tag").AsSlice()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a", "b"}, formTags)
+	name, err := ctx.FormValueV1("name").String()
+	require.NoError(t, err)
+	assert.Equal(t, "Tom", name)
+
+	ips, err := ctx.HeaderValue("x-forwarded-for").AsSlice()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, ips)
+	assert.False(t, ctx.HeaderValue("X-Token").Exists())
+
+	sid, err := ctx.CookieValue("sid").String()
+	require.NoError(t, err)
+	assert.Equal(t, "s1", sid)
+	assert.False(t, ctx.CookieValue("token").Exists())
+}
+
+func TestStringValue_DefaultKeepsError(t *testing.T) {
+	// 表单解析失败不是 key 不存在, Default 不能把错误吞掉
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("broken"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=abc")
+	ctx := &Context{Req: req}
+
+	val := ctx.FormValueV1("limit")
+	assert.False(t, val.Exists())
+	_, err := val.Default("10").AsInt()
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrKeyNotFound)
+}
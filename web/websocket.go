@@ -0,0 +1,457 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 消息类型, 和 RFC 6455 里面的 opcode 一致
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// 关闭码, 只列了常用的
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	CloseMessageTooBig    = 1009
+)
+
+// websocketGUID 握手的时候拼在 Sec-WebSocket-Key 后面
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	ErrWebSocketClosed = errors.New("web: websocket 连接已经关闭")
+	errBadHandshake    = errors.New("web: 不是合法的 websocket 握手请求")
+)
+
+// CloseError 对端发过来的关闭帧
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("web: websocket 关闭 %d %s", e.Code, e.Reason)
+}
+
+// WebSocketHandler websocket 路由的业务逻辑, 返回之后连接会被关闭
+type WebSocketHandler func(ctx *Context, conn *WebSocketConn)
+
+// WebSocket 注册 websocket 路由
+// 路由上的中间件(比如说鉴权)会在握手之前执行
+func (h *HTTPServer) WebSocket(path string, handler WebSocketHandler, opts ...WebSocketOption) {
+	h.Get(path, func(ctx *Context) {
+		conn, err := ctx.Upgrade(opts...)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(ctx, conn)
+	})
+}
+
+type websocketConfig struct {
+	checkOrigin    func(req *http.Request) bool
+	maxMessageSize int64
+	subprotocols   []string
+}
+
+type WebSocketOption func(cfg *websocketConfig)
+
+// WebSocketWithCheckOrigin 设置 Origin 的检查, 默认要求 Origin 和 Host 一致
+func WebSocketWithCheckOrigin(fn func(req *http.Request) bool) WebSocketOption {
+	return func(cfg *websocketConfig) {
+		cfg.checkOrigin = fn
+	}
+}
+
+// WebSocketWithMaxMessageSize 单条消息的最大字节数, 超过了会以 1009 关闭连接
+func WebSocketWithMaxMessageSize(n int64) WebSocketOption {
+	return func(cfg *websocketConfig) {
+		cfg.maxMessageSize = n
+	}
+}
+
+// WebSocketWithSubprotocols 服务端支持的子协议, 按照优先级排序
+func WebSocketWithSubprotocols(protocols ...string) WebSocketOption {
+	return func(cfg *websocketConfig) {
+		cfg.subprotocols = protocols
+	}
+}
+
+// Upgrade 完成 websocket 握手, 接管底层的连接
+// 握手失败的时候会设置好 RespStatusCode 和 RespData, 并且返回 error
+// 握手成功之后, RespData 不会再被写出去
+func (c *Context) Upgrade(opts ...WebSocketOption) (*WebSocketConn, error) {
+	cfg := &websocketConfig{
+		checkOrigin:    sameOrigin,
+		maxMessageSize: 1 << 20,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	req := c.Req
+	if req.Method != http.MethodGet ||
+		!headerContainsToken(req.Header, "Connection", "upgrade") ||
+		!headerContainsToken(req.Header, "Upgrade", "websocket") {
+		c.RespStatusCode = http.StatusBadRequest
+		c.RespData = []byte("Bad Request")
+		return nil, errBadHandshake
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		c.Resp.Header().Set("Sec-WebSocket-Version", "13")
+		c.RespStatusCode = http.StatusUpgradeRequired
+		c.RespData = []byte("Upgrade Required")
+		return nil, errBadHandshake
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		c.RespStatusCode = http.StatusBadRequest
+		c.RespData = []byte("Bad Request")
+		return nil, errBadHandshake
+	}
+	if !cfg.checkOrigin(req) {
+		c.RespStatusCode = http.StatusForbidden
+		c.RespData = []byte("Forbidden")
+		return nil, errors.New("web: websocket 的 Origin 不允许")
+	}
+
+	netConn, brw, err := http.NewResponseController(c.Resp).Hijack()
+	if err != nil {
+		c.RespStatusCode = http.StatusInternalServerError
+		c.RespData = []byte("Internal Server Error")
+		return nil, err
+	}
+	// 握手成功之后, 响应由我们自己写, flashResp 不能再写了
+	c.committed = true
+	c.RespStatusCode = http.StatusSwitchingProtocols
+	// http.Server 设置的超时对长连接没有意义
+	_ = netConn.SetDeadline(time.Time{})
+
+	var sb strings.Builder
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	sb.WriteString(websocketAccept(key))
+	sb.WriteString("\r\n")
+	if protocol := selectSubprotocol(req, cfg.subprotocols); protocol != "" {
+		sb.WriteString("Sec-WebSocket-Protocol: ")
+		sb.WriteString(protocol)
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString("\r\n")
+	if _, err = netConn.Write([]byte(sb.String())); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+
+	return &WebSocketConn{
+		conn:           netConn,
+		reader:         brw.Reader,
+		maxMessageSize: cfg.maxMessageSize,
+	}, nil
+}
+
+// WebSocketConn 一个 websocket 连接
+// 同一时间只能有一个 goroutine 读, 写是并发安全的
+type WebSocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	closed     bool
+
+	maxMessageSize int64
+
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+}
+
+// SetPingHandler 默认收到 ping 之后会自动回复 pong
+func (w *WebSocketConn) SetPingHandler(fn func(data []byte) error) {
+	w.pingHandler = fn
+}
+
+// SetPongHandler 收到 pong 的时候调用, 一般用来延长读超时
+func (w *WebSocketConn) SetPongHandler(fn func(data []byte) error) {
+	w.pongHandler = fn
+}
+
+func (w *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return w.conn.SetReadDeadline(t)
+}
+
+func (w *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return w.conn.SetWriteDeadline(t)
+}
+
+func (w *WebSocketConn) RemoteAddr() net.Addr {
+	return w.conn.RemoteAddr()
+}
+
+// ReadMessage 读一条完整的消息, 分片的消息会被拼起来
+// ping 和 pong 在这里面处理掉, 收到关闭帧会回复关闭帧, 然后返回 *CloseError
+func (w *WebSocketConn) ReadMessage() (int, []byte, error) {
+	var msgType int
+	var msg []byte
+	for {
+		fin, opcode, payload, err := w.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if w.pingHandler != nil {
+				err = w.pingHandler(payload)
+			} else {
+				err = w.WriteControl(PongMessage, payload)
+			}
+			if err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if w.pongHandler != nil {
+				if err = w.pongHandler(payload); err != nil {
+					return 0, nil, err
+				}
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, w.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				return 0, nil, w.fail(CloseProtocolError, "上一条消息还没有结束")
+			}
+			msgType = opcode
+		case continuationFrame:
+			if msgType == 0 {
+				return 0, nil, w.fail(CloseProtocolError, "没有需要继续的消息")
+			}
+		default:
+			return 0, nil, w.fail(CloseProtocolError, "未知的 opcode")
+		}
+
+		if int64(len(msg)+len(payload)) > w.maxMessageSize {
+			return 0, nil, w.fail(CloseMessageTooBig, "消息太大")
+		}
+		msg = append(msg, payload...)
+		if !fin {
+			continue
+		}
+		if msgType == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, w.fail(CloseInvalidPayload, "不是合法的 UTF-8")
+		}
+		return msgType, msg, nil
+	}
+}
+
+// readFrame 读一帧, 客户端发过来的帧必须有掩码
+func (w *WebSocketConn) readFrame() (bool, int, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(w.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, w.fail(CloseProtocolError, "不支持扩展")
+	}
+	opcode := int(head[0] & 0x0f)
+	masked := head[1]&0x80 != 0
+	if !masked {
+		return false, 0, nil, w.fail(CloseProtocolError, "客户端的帧必须有掩码")
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(w.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(w.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if opcode >= CloseMessage && (length > 125 || !fin) {
+		return false, 0, nil, w.fail(CloseProtocolError, "控制帧不合法")
+	}
+	if length < 0 || length > w.maxMessageSize {
+		return false, 0, nil, w.fail(CloseMessageTooBig, "消息太大")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(w.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(w.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage 发送一条文本或者二进制消息
+func (w *WebSocketConn) WriteMessage(msgType int, data []byte) error {
+	if msgType != TextMessage && msgType != BinaryMessage {
+		return fmt.Errorf("web: 不支持的消息类型 %d", msgType)
+	}
+	return w.writeFrame(msgType, data)
+}
+
+// WriteControl 发送控制帧, 数据不能超过 125 个字节
+func (w *WebSocketConn) WriteControl(msgType int, data []byte) error {
+	if msgType != CloseMessage && msgType != PingMessage && msgType != PongMessage {
+		return fmt.Errorf("web: 不是控制帧 %d", msgType)
+	}
+	if len(data) > 125 {
+		return errors.New("web: 控制帧的数据不能超过 125 个字节")
+	}
+	return w.writeFrame(msgType, data)
+}
+
+// Ping 发送 ping, 对端回复的 pong 会交给 SetPongHandler 设置的回调
+func (w *WebSocketConn) Ping(data []byte) error {
+	return w.WriteControl(PingMessage, data)
+}
+
+// writeFrame 服务端发送的帧不需要掩码, 一次 Write 写完, 防止和别的帧交错
+func (w *WebSocketConn) writeFrame(opcode int, data []byte) error {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	if w.closed {
+		return ErrWebSocketClosed
+	}
+
+	frame := make([]byte, 0, len(data)+10)
+	frame = append(frame, 0x80|byte(opcode))
+	switch {
+	case len(data) <= 125:
+		frame = append(frame, byte(len(data)))
+	case len(data) <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(data)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(data)))
+	}
+	frame = append(frame, data...)
+	_, err := w.conn.Write(frame)
+	if opcode == CloseMessage {
+		w.closed = true
+	}
+	return err
+}
+
+// CloseWithCode 发送关闭帧, 然后关闭连接
+func (w *WebSocketConn) CloseWithCode(code int, reason string) error {
+	var err error
+	w.closeOnce.Do(func() {
+		_ = w.writeFrame(CloseMessage, closePayload(code, reason))
+		err = w.conn.Close()
+	})
+	return err
+}
+
+// Close 正常关闭连接
+func (w *WebSocketConn) Close() error {
+	return w.CloseWithCode(CloseNormalClosure, "")
+}
+
+// handleClose 收到关闭帧, 原样回复关闭码
+func (w *WebSocketConn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+	}
+	code := closeErr.Code
+	if code == CloseNoStatusReceived {
+		code = CloseNormalClosure
+	}
+	_ = w.CloseWithCode(code, "")
+	return closeErr
+}
+
+// fail 协议错误, 关闭连接
+func (w *WebSocketConn) fail(code int, reason string) error {
+	_ = w.CloseWithCode(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func closePayload(code int, reason string) []byte {
+	payload := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(reason)), uint16(code))
+	return append(payload, reason...)
+}
+
+// websocketAccept 计算 Sec-WebSocket-Accept
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContainsToken 头部是逗号分隔的 token 列表, 比如说 Connection: keep-alive, Upgrade
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, val := range header.Values(name) {
+		for _, t := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func selectSubprotocol(req *http.Request, supported []string) string {
+	for _, protocol := range supported {
+		if headerContainsToken(req.Header, "Sec-WebSocket-Protocol", protocol) {
+			return protocol
+		}
+	}
+	return ""
+}
+
+// sameOrigin 浏览器会带上 Origin, 要求和 Host 一致, 防止跨站的 websocket 劫持
+// 没有 Origin 的不是浏览器发的, 放行
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
@@ -0,0 +1,191 @@
+package web
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebsocketAccept(t *testing.T) {
+	// RFC 6455 里面的例子
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestHTTPServer_WebSocket(t *testing.T) {
+	server := NewHTTPServer()
+	server.Use(http.MethodGet, "/ws/:room", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if ctx.Req.Header.Get("Authorization") == "" {
+				ctx.RespStatusCode = http.StatusUnauthorized
+				ctx.RespData = []byte("Unauthorized")
+				return
+			}
+			next(ctx)
+		}
+	})
+	server.WebSocket("/ws/:room", func(ctx *Context, conn *WebSocketConn) {
+		room, _ := ctx.PathValue("room")
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(typ, append([]byte(room+":"), msg...)); err != nil {
+				return
+			}
+		}
+	}, WebSocketWithMaxMessageSize(1024))
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	t.Run("middleware reject", func(t *testing.T) {
+		conn, reader := dialWebSocket(t, addr, "/ws/go", "", false)
+		defer conn.Close()
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("bad handshake", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/ws/go")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		// 没有 Authorization 先被中间件拦下来
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/ws/go", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "token")
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("cross origin", func(t *testing.T) {
+		conn, reader := dialWebSocket(t, addr, "/ws/go", "http://evil.com", true)
+		defer conn.Close()
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("echo", func(t *testing.T) {
+		conn, reader := dialWebSocket(t, addr, "/ws/go", "http://"+addr, true)
+		defer conn.Close()
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+		// 文本消息
+		writeClientFrame(t, conn, true, TextMessage, []byte("hello"))
+		fin, opcode, payload := readServerFrame(t, reader)
+		assert.True(t, fin)
+		assert.Equal(t, TextMessage, opcode)
+		assert.Equal(t, "go:hello", string(payload))
+
+		// 分片的消息, 中间夹了一个 ping
+		writeClientFrame(t, conn, false, BinaryMessage, []byte("wor"))
+		writeClientFrame(t, conn, true, PingMessage, []byte("p"))
+		writeClientFrame(t, conn, true, continuationFrame, []byte("ld"))
+		_, opcode, payload = readServerFrame(t, reader)
+		assert.Equal(t, PongMessage, opcode)
+		assert.Equal(t, "p", string(payload))
+		_, opcode, payload = readServerFrame(t, reader)
+		assert.Equal(t, BinaryMessage, opcode)
+		assert.Equal(t, "go:world", string(payload))
+
+		// 关闭
+		writeClientFrame(t, conn, true, CloseMessage, closePayload(CloseGoingAway, "bye"))
+		_, opcode, payload = readServerFrame(t, reader)
+		assert.Equal(t, CloseMessage, opcode)
+		assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+		_, err = reader.ReadByte()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("message too big", func(t *testing.T) {
+		conn, reader := dialWebSocket(t, addr, "/ws/go", "", true)
+		defer conn.Close()
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+		writeClientFrame(t, conn, true, BinaryMessage, make([]byte, 2048))
+		_, opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, CloseMessage, opcode)
+		assert.Equal(t, CloseMessageTooBig, int(binary.BigEndian.Uint16(payload)))
+	})
+}
+
+func dialWebSocket(t *testing.T, addr string, path string, origin string, auth bool) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	req := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + addr + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	if auth {
+		req += "Authorization: token\r\n"
+	}
+	if origin != "" {
+		req += "Origin: " + origin + "\r\n"
+	}
+	_, err = conn.Write([]byte(req + "\r\n"))
+	require.NoError(t, err)
+	return conn, bufio.NewReader(conn)
+}
+
+// writeClientFrame 客户端发的帧要带掩码
+func writeClientFrame(t *testing.T, conn net.Conn, fin bool, opcode int, data []byte) {
+	head := byte(opcode)
+	if fin {
+		head |= 0x80
+	}
+	frame := []byte{head}
+	switch {
+	case len(data) <= 125:
+		frame = append(frame, 0x80|byte(len(data)))
+	default:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(data)))
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame = append(frame, mask[:]...)
+	for i, b := range data {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func readServerFrame(t *testing.T, reader *bufio.Reader) (bool, int, []byte) {
+	var head [2]byte
+	_, err := io.ReadFull(reader, head[:])
+	require.NoError(t, err)
+	require.Zero(t, head[1]&0x80, "服务端的帧不能有掩码")
+	length := int(head[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		_, err = io.ReadFull(reader, ext[:])
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	require.NoError(t, err)
+	return head[0]&0x80 != 0, int(head[0] & 0x0f), payload
+}